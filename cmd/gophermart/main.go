@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os/signal"
+	"syscall"
 
 	"github.com/amiosamu/gofemart/internal/transport"
 	"github.com/amiosamu/gofemart/internal/config"
@@ -17,9 +20,16 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apikey AdminKeyAuth
+// @in header
+// @name X-Admin-Token
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	server := transport.NewAPIServer(config.NewConfig())
-	if err := server.Start(); err != nil {
+	if err := server.Start(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
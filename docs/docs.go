@@ -15,6 +15,399 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/admin/dead-letters": {
+            "get": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Выводит заказы, исключённые из опроса системы расчёта после повторяющихся сбоев обработки, с последней ошибкой и исходным ответом.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "GetDeadLetters",
+                "operationId": "get dead letters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.DeadLetter"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "Status No Content"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/admin/dead-letters/{number}/discard": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Убирает заказ из списка сбойных. Заказ остаётся в текущем статусе и не опрашивается, пока его не вернут в очередь через retry.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "DiscardDeadLetter",
+                "operationId": "discard dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/admin/dead-letters/{number}/retry": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Сбрасывает счётчики сбоев и проверок заказа и возвращает его в очередь опроса системы расчёта.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "RetryDeadLetter",
+                "operationId": "retry dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Status Accepted"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/admin/orders/{number}/bump": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Ставит необработанный заказ в начало очереди опроса системы расчёта и назначает проверку на ближайший раунд.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "BumpOrder",
+                "operationId": "bump order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Status Accepted"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/admin/orders/{number}/recheck": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Синхронно запрашивает расчёт по заказу в системе расчёта, применяет его по правилам переходов статусов и возвращает исходный ответ системы расчёта вместе с сохранённым заказом.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "RecheckOrder",
+                "operationId": "recheck order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.RecheckResult"
+                        }
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    },
+                    "502": {
+                        "description": "Bad Gateway"
+                    },
+                    "503": {
+                        "description": "Service Unavailable"
+                    }
+                }
+            }
+        },
+        "/api/admin/orders/{number}/requeue": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает заказ в статусе UNREGISTERED в очередь опроса системы расчёта.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "RequeueOrder",
+                "operationId": "requeue order",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Status Accepted"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/admin/withdrawals/{number}/reverse": {
+            "post": {
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ],
+                "description": "Отменяет списание баллов по номеру заказа и возвращает баллы пользователю. Возврат записывается в журнал баллов со ссылкой на списание.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "ReverseWithdraw",
+                "operationId": "reverse withdraw",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Withdraw"
+                        }
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Status Unprocessable Entity"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/health": {
+            "get": {
+                "description": "Выводит состояние сервиса, автоматов защиты обращений к каждой системе расчёта и фоновых задач и лидерства в задачах-одиночках. Статус degraded означает, что хотя бы одна система расчёта недоступна.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health",
+                "operationId": "health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/transport.Health"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/api/merchant/withdrawals/reverse": {
+            "post": {
+                "description": "Отменяет списание баллов по заказу, отменённому в магазине, и возвращает баллы пользователю. Запрос подписывается HMAC-SHA256 с общим секретом от строки \"\u003cX-Timestamp\u003e.\u003cтело запроса\u003e\"; подписи старше 5 минут отклоняются. Секрет общий для всех магазинов, а списание не связано с магазином, поэтому отмена не ограничена списаниями магазина, подписавшего запрос: любой владелец секрета может отменить любое списание.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "withdraw"
+                ],
+                "summary": "MerchantReverseWithdraw",
+                "operationId": "merchant reverse withdraw",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "время подписи в секундах Unix",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "hex HMAC-SHA256 от \\",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "номер заказа списания",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.WithdrawReversal"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Withdraw"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large"
+                    },
+                    "422": {
+                        "description": "Status Unprocessable Entity"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
         "/api/user/balance": {
             "get": {
                 "security": [
@@ -89,6 +482,9 @@ const docTemplate = `{
                     },
                     "500": {
                         "description": "Internal Server Error"
+                    },
+                    "503": {
+                        "description": "Service Unavailable"
                     }
                 }
             }
@@ -222,6 +618,53 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/user/orders/{number}/history": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Выводит историю изменения статусов заказа пользователя с исходными ответами системы расчёта.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "GetOrderHistory",
+                "operationId": "get order history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "order ID",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.OrderStatusChange"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
         "/api/user/register": {
             "post": {
                 "description": "Отвечает за регистрацию пользователя по логину и паролю. Автоматически производит аутентификацию.",
@@ -302,9 +745,128 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/internal/accrual/callback": {
+            "post": {
+                "description": "Принимает статусы расчёта начислений сразу по нескольким заказам от системы расчёта и применяет их одной транзакцией. Если заказ встречается в запросе несколько раз, применяется последний статус. Запрос подписывается HMAC-SHA256 с общим секретом от строки \"\u003cX-Timestamp\u003e.\u003cтело запроса\u003e\"; подписи старше 5 минут отклоняются.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "accrual"
+                ],
+                "summary": "AccrualCallback",
+                "operationId": "accrual callback",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "время подписи в секундах Unix",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "hex HMAC-SHA256 от \\",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "статусы заказов",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.ScoringSystem"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.CallbackResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Status Unauthorized"
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "accrual.BreakerState": {
+            "type": "string",
+            "enum": [
+                "closed",
+                "open",
+                "half-open"
+            ],
+            "x-enum-varnames": [
+                "BreakerClosed",
+                "BreakerOpen",
+                "BreakerHalfOpen"
+            ]
+        },
+        "accrual.BreakerStatus": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "opened_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "$ref": "#/definitions/accrual.BreakerState"
+                }
+            }
+        },
+        "accrual.ProviderStatus": {
+            "type": "object",
+            "properties": {
+                "breaker": {
+                    "$ref": "#/definitions/accrual.BreakerStatus"
+                },
+                "callback": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "throttle": {
+                    "$ref": "#/definitions/accrual.ThrottleState"
+                }
+            }
+        },
+        "accrual.ThrottleState": {
+            "type": "object",
+            "properties": {
+                "paused_until": {
+                    "type": "string"
+                },
+                "rate_limit": {
+                    "type": "integer"
+                }
+            }
+        },
         "domain.BalanceOutput": {
             "type": "object",
             "properties": {
@@ -316,6 +878,43 @@ const docTemplate = `{
                 }
             }
         },
+        "domain.CallbackResult": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "domain.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "failures": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "order": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/domain.OrderStatus"
+                }
+            }
+        },
         "domain.Order": {
             "type": "object",
             "properties": {
@@ -340,16 +939,71 @@ const docTemplate = `{
                 "PROCESSING",
                 "REGISTERED",
                 "INVALID",
-                "PROCESSED"
+                "PROCESSED",
+                "UNREGISTERED"
             ],
             "x-enum-varnames": [
                 "NewOrder",
                 "Processing",
                 "Registered",
                 "Invalid",
-                "Processed"
+                "Processed",
+                "Unregistered"
             ]
         },
+        "domain.OrderStatusChange": {
+            "type": "object",
+            "properties": {
+                "accrual": {
+                    "type": "number"
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "from": {
+                    "$ref": "#/definitions/domain.OrderStatus"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "to": {
+                    "$ref": "#/definitions/domain.OrderStatus"
+                }
+            }
+        },
+        "domain.RecheckResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error — почему ответ не применён к заказу, например запрещённый переход статуса.",
+                    "type": "string"
+                },
+                "order": {
+                    "$ref": "#/definitions/domain.Order"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "response": {
+                    "description": "Response — исходный ответ системы расчёта, пустой, если она не знает о заказе.",
+                    "type": "object"
+                }
+            }
+        },
+        "domain.ScoringSystem": {
+            "type": "object",
+            "properties": {
+                "accrual": {
+                    "type": "number"
+                },
+                "order": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/domain.OrderStatus"
+                }
+            }
+        },
         "domain.SighUpAndInInput": {
             "type": "object",
             "required": [
@@ -376,13 +1030,100 @@ const docTemplate = `{
                 "processed_at": {
                     "type": "string"
                 },
+                "reversed_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/domain.WithdrawStatus"
+                },
                 "sum": {
                     "type": "number"
                 }
             }
+        },
+        "domain.WithdrawReversal": {
+            "type": "object",
+            "properties": {
+                "order": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.WithdrawStatus": {
+            "type": "string",
+            "enum": [
+                "COMPLETED",
+                "REVERSED"
+            ],
+            "x-enum-varnames": [
+                "WithdrawCompleted",
+                "WithdrawReversed"
+            ]
+        },
+        "scheduler.JobStatus": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "last_run": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "next_run": {
+                    "type": "string"
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "runs": {
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Skipped — запуски, пропущенные из-за того, что предыдущий ещё не завершился.",
+                    "type": "integer"
+                }
+            }
+        },
+        "transport.Health": {
+            "type": "object",
+            "properties": {
+                "accrual": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/accrual.ProviderStatus"
+                    }
+                },
+                "jobs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scheduler.JobStatus"
+                    }
+                },
+                "leaders": {
+                    "description": "Leaders — задачи-одиночки и признак того, что их выполняет этот экземпляр.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "boolean"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
+        "AdminKeyAuth": {
+            "type": "apiKey",
+            "name": "X-Admin-Token",
+            "in": "header"
+        },
         "ApiKeyAuth": {
             "type": "apiKey",
             "name": "Authorization",
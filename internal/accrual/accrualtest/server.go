@@ -0,0 +1,150 @@
+// Package accrualtest содержит поддельную систему расчёта начислений на основе httptest
+// для проверки опроса заказов без настоящего сервиса.
+package accrualtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Response — один заранее заданный ответ поддельной системы расчёта.
+type Response struct {
+	Code    int
+	Status  domain.OrderStatus
+	Accrual *decimal.Decimal
+	// RetryAfter и Limit используются только для 429.
+	RetryAfter int
+	Limit      int
+}
+
+func Registered() Response {
+	return Response{Code: http.StatusOK, Status: domain.Registered}
+}
+
+func Processing() Response {
+	return Response{Code: http.StatusOK, Status: domain.Processing}
+}
+
+func Processed(accrual decimal.Decimal) Response {
+	return Response{Code: http.StatusOK, Status: domain.Processed, Accrual: &accrual}
+}
+
+func Invalid() Response {
+	return Response{Code: http.StatusOK, Status: domain.Invalid}
+}
+
+func NoContent() Response {
+	return Response{Code: http.StatusNoContent}
+}
+
+func TooManyRequests(retryAfter, limit int) Response {
+	return Response{Code: http.StatusTooManyRequests, RetryAfter: retryAfter, Limit: limit}
+}
+
+func InternalError() Response {
+	return Response{Code: http.StatusInternalServerError}
+}
+
+// Server отвечает на GET /api/orders/{number} по сценарию, заданному для каждого заказа.
+// Ответы сценария выдаются по очереди, последний повторяется. Для заказов без сценария возвращается 204.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scripts  map[string][]Response
+	calls    map[string]int
+	fallback Response
+}
+
+func NewServer() *Server {
+	s := &Server{
+		scripts:  make(map[string][]Response),
+		calls:    make(map[string]int),
+		fallback: NoContent(),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Script задаёт последовательность ответов для заказа.
+func (s *Server) Script(orderID string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[orderID] = responses
+}
+
+// Default задаёт ответ для заказов без сценария.
+func (s *Server) Default(response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = response
+}
+
+// Calls возвращает число запросов по заказу.
+func (s *Server) Calls(orderID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[orderID]
+}
+
+func (s *Server) next(orderID string) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[orderID]++
+	script, ok := s.scripts[orderID]
+	if !ok || len(script) == 0 {
+		return s.fallback
+	}
+
+	if len(script) > 1 {
+		s.scripts[orderID] = script[1:]
+	}
+	return script[0]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := strings.CutPrefix(r.URL.Path, "/api/orders/")
+	if r.Method != http.MethodGet || !ok || orderID == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp := s.next(orderID)
+	switch resp.Code {
+	case http.StatusOK:
+		// Система расчёта передаёт начисление числом.
+		var accrual *domain.Amount
+		if resp.Accrual != nil {
+			amount := domain.NewAmount(*resp.Accrual)
+			accrual = &amount
+		}
+		body, err := json.Marshal(struct {
+			Order   string             `json:"order"`
+			Status  domain.OrderStatus `json:"status"`
+			Accrual *domain.Amount     `json:"accrual,omitempty"`
+		}{orderID, resp.Status, accrual})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", resp.Limit)
+	default:
+		w.WriteHeader(resp.Code)
+	}
+}
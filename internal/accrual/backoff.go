@@ -0,0 +1,37 @@
+package accrual
+
+import (
+	"time"
+)
+
+// maxDelay ограничивает задержку, если Backoff.Max не задан, чтобы срок следующей проверки
+// оставался в пределах, которые хранит база.
+const maxDelay = 365 * 24 * time.Hour
+
+// Backoff вычисляет задержку до следующей проверки заказа: Base, 2*Base, 4*Base... но не больше Max.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// ceiling возвращает наибольшую задержку между проверками: Max или maxDelay, если Max не задан.
+func (b Backoff) ceiling() time.Duration {
+	if b.Max > 0 {
+		return b.Max
+	}
+	return maxDelay
+}
+
+// Next возвращает задержку после attempts уже выполненных проверок.
+func (b Backoff) Next(attempts int) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+
+	ceiling := b.ceiling()
+	delay := b.Base
+	for i := 0; i < attempts && delay < ceiling; i++ {
+		delay *= 2
+	}
+	return min(delay, ceiling)
+}
@@ -0,0 +1,203 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen возвращается без обращения к системе расчёта, пока автомат разомкнут.
+var ErrCircuitOpen = errors.New("accrual: circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerStatus — текущее состояние автомата для health-проверки.
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+}
+
+// Breaker размыкается после threshold сбоев подряд и не пропускает запросы в течение cooldown.
+// Затем пропускает один пробный запрос: успех замыкает автомат, сбой снова размыкает.
+type Breaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+	logger    *log.Logger
+
+	name   string
+	metric *expvar.String
+}
+
+// NewBreaker создаёт автомат для провайдера name.
+func NewBreaker(name string, threshold int, cooldown time.Duration, logger *log.Logger) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	metric := new(expvar.String)
+	metric.Set(string(BreakerClosed))
+	providerMetrics(name).Set("breaker_state", metric)
+	return &Breaker{
+		state:     BreakerClosed,
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+		name:      name,
+		metric:    metric,
+	}
+}
+
+// Allow сообщает, можно ли сейчас обратиться к системе расчёта.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success отмечает успешное обращение и замыкает автомат.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure отмечает сбой и размыкает автомат, если сбоев набралось threshold или сбоем закончилась проба.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.state == BreakerClosed && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Cancel отмечает обращение, прерванное вызывающей стороной, не меняя состояния автомата.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	b.logger.WithFields(log.Fields{
+		"worker":   "accrual",
+		"provider": b.name,
+		"from":     b.state,
+		"to":       state,
+		"failures": b.failures,
+	}).Warn("accrual circuit breaker state changed")
+	b.state = state
+	b.metric.Set(string(state))
+}
+
+type breakerClient struct {
+	next    Client
+	breaker *Breaker
+}
+
+// WithBreaker пропускает обращения client через автомат breaker. Сбоями считаются сетевые ошибки
+// и ответы 5xx; 204, 429 и неразборчивый ответ означают, что система расчёта доступна.
+func WithBreaker(client Client, breaker *Breaker) Client {
+	return &breakerClient{
+		next:    client,
+		breaker: breaker,
+	}
+}
+
+func (c *breakerClient) GetOrder(ctx context.Context, orderID string) (*domain.ScoringSystem, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	order, err := c.next.GetOrder(ctx, orderID)
+	switch {
+	case ctx.Err() != nil:
+		c.breaker.Cancel()
+	case isUnavailable(err):
+		c.breaker.Failure()
+	default:
+		c.breaker.Success()
+	}
+	return order, err
+}
+
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrNotRegistered) {
+		return false
+	}
+
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		return false
+	}
+
+	var payloadErr *PayloadError
+	if errors.As(err, &payloadErr) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	return true
+}
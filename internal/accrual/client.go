@@ -0,0 +1,83 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/httpclient"
+)
+
+// ErrNotRegistered возвращается, когда система расчёта не знает о заказе (204 No Content).
+var ErrNotRegistered = errors.New("accrual: order is not registered")
+
+// Client запрашивает расчёт начислений по заказу в системе расчёта.
+type Client interface {
+	GetOrder(ctx context.Context, orderID string) (*domain.ScoringSystem, error)
+}
+
+// StatusError — неожиданный код ответа системы расчёта.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("accrual: unexpected status %d", e.Code)
+}
+
+// PayloadError — ответ системы расчёта не удалось разобрать.
+type PayloadError struct {
+	Payload []byte
+	Err     error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("accrual: bad payload %s", e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPClient обращается к системе расчёта по HTTP: GET {addr}/api/orders/{number}.
+type HTTPClient struct {
+	addr   string
+	client *httpclient.Client
+}
+
+func NewHTTPClient(addr string, client *httpclient.Client) *HTTPClient {
+	return &HTTPClient{
+		addr:   addr,
+		client: client,
+	}
+}
+
+// GetOrder возвращает ErrNotRegistered на 204, *RateLimitError на 429 и *StatusError на прочие коды, кроме 200.
+// Если тело ответа 200 не разбирается, возвращает *PayloadError.
+func (c *HTTPClient) GetOrder(ctx context.Context, orderID string) (*domain.ScoringSystem, error) {
+	resp, err := c.client.Get(ctx, fmt.Sprintf("%s/api/orders/%s", c.addr, url.PathEscape(orderID)))
+	if err != nil {
+		return nil, fmt.Errorf("accrual: getOrder %s", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, ErrNotRegistered
+	case http.StatusTooManyRequests:
+		return nil, newRateLimitError(resp.Header, resp.Body)
+	default:
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	var order domain.ScoringSystem
+	if err := json.Unmarshal(resp.Body, &order); err != nil {
+		return nil, &PayloadError{Payload: resp.Body, Err: err}
+	}
+	order.Payload = resp.Body
+	return &order, nil
+}
@@ -0,0 +1,26 @@
+package accrual
+
+import (
+	"expvar"
+	"sync"
+)
+
+// Метрики опроса систем расчёта, доступны через /debug/vars. Метрики каждого провайдера
+// собраны во вложенной карте под его именем.
+var (
+	metrics   = expvar.NewMap("accrual")
+	metricsMu sync.Mutex
+)
+
+// providerMetrics возвращает карту метрик провайдера name, создавая её при первом обращении.
+func providerMetrics(name string) *expvar.Map {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if m, ok := metrics.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map).Init()
+	metrics.Set(name, m)
+	return m
+}
@@ -0,0 +1,37 @@
+package accrual
+
+import (
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+)
+
+// Policy определяет, как часто проверяется заказ. Свежие заказы проверяются по расписанию Backoff,
+// а заказы старше FreshAge — в AgedFactor раз реже, чтобы застрявшие заказы не отнимали запросы у новых.
+// Задержка не превышает Backoff.Max ни для каких заказов.
+// Очерёдность захвата задаёт хранилище: сначала поднятые администратором, затем недавно загруженные.
+type Policy struct {
+	Backoff Backoff
+	// FreshAge — возраст, до которого заказ считается свежим, 0 — все заказы свежие.
+	FreshAge time.Duration
+	// AgedFactor — во сколько раз реже проверяются заказы старше FreshAge, 0 и 1 — так же часто.
+	AgedFactor int
+}
+
+// Next возвращает задержку до следующей проверки заказа.
+func (p Policy) Next(pending domain.PendingOrder, now time.Time) time.Duration {
+	delay := p.Backoff.Next(pending.Attempts)
+	if !p.aged(pending, now) {
+		return delay
+	}
+
+	ceiling := p.Backoff.ceiling()
+	if delay > ceiling/time.Duration(p.AgedFactor) {
+		return ceiling
+	}
+	return delay * time.Duration(p.AgedFactor)
+}
+
+func (p Policy) aged(pending domain.PendingOrder, now time.Time) bool {
+	return p.FreshAge > 0 && p.AgedFactor > 1 && now.Sub(pending.UploadedAt) > p.FreshAge
+}
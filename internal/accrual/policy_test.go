@@ -0,0 +1,64 @@
+package accrual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+)
+
+func TestBackoffNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		attempts int
+		want     time.Duration
+	}{
+		{"first check", Backoff{Base: time.Second, Max: time.Minute}, 0, time.Second},
+		{"doubles", Backoff{Base: time.Second, Max: time.Minute}, 3, 8 * time.Second},
+		{"max ceiling", Backoff{Base: time.Second, Max: time.Minute}, 10, time.Minute},
+		{"max below base", Backoff{Base: time.Minute, Max: time.Second}, 0, time.Second},
+		{"no base", Backoff{Max: time.Minute}, 5, 0},
+		{"no max", Backoff{Base: time.Second}, 10, 1024 * time.Second},
+		{"no max overflow", Backoff{Base: time.Second}, 1000, maxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Next(tt.attempts); got != tt.want {
+				t.Errorf("Next(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyNext(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	fresh := domain.PendingOrder{Attempts: 2, UploadedAt: now.Add(-time.Minute)}
+	aged := domain.PendingOrder{Attempts: 2, UploadedAt: now.Add(-2 * time.Hour)}
+	backoff := Backoff{Base: time.Second, Max: time.Minute}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		pending domain.PendingOrder
+		want    time.Duration
+	}{
+		{"fresh order", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 3}, fresh, 4 * time.Second},
+		{"aged order", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 3}, aged, 12 * time.Second},
+		{"aged order capped at max", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 3}, domain.PendingOrder{Attempts: 5, UploadedAt: aged.UploadedAt}, time.Minute},
+		{"aged order past max", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 3}, domain.PendingOrder{Attempts: 10, UploadedAt: aged.UploadedAt}, time.Minute},
+		{"aged factor 0", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 0}, aged, 4 * time.Second},
+		{"aged factor 1", Policy{Backoff: backoff, FreshAge: time.Hour, AgedFactor: 1}, aged, 4 * time.Second},
+		{"no fresh age", Policy{Backoff: backoff, AgedFactor: 3}, aged, 4 * time.Second},
+		{"overflow clamp", Policy{Backoff: Backoff{Base: time.Second}, FreshAge: time.Hour, AgedFactor: 3}, domain.PendingOrder{Attempts: 1000, UploadedAt: aged.UploadedAt}, maxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Next(tt.pending, now); got != tt.want {
+				t.Errorf("Next() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// Repository описывает хранилище заказов, ожидающих расчёта начислений.
+type Repository interface {
+	GetOrderStatus(ctx context.Context, owner string, lease time.Duration, limit int) ([]domain.PendingOrder, error)
+	UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error)
+	RescheduleOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error
+	PostponeOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error
+	ExpireOrder(ctx context.Context, owner string, orderID string) error
+	FailOrder(ctx context.Context, owner string, failure domain.OrderFailure, maxFailures int) (bool, error)
+}
+
+// Config — параметры опроса системы расчёта начислений.
+type Config struct {
+	Workers int
+
+	// Owner — идентификатор экземпляра сервиса, от имени которого арендуются заказы.
+	Owner string
+	// Lease — срок аренды заказа, после которого его может забрать другой экземпляр.
+	Lease     time.Duration
+	BatchSize int
+	// Policy задаёт интервал между повторными проверками одного заказа.
+	Policy Policy
+
+	// MaxAttempts и MaxAge ограничивают ожидание регистрации нового заказа в системе расчёта.
+	// После любого из них заказ переводится в UNREGISTERED. 0 — без ограничения.
+	MaxAttempts int
+	MaxAge      time.Duration
+
+	// MaxFailures — число сбоев обработки ответа, после которого заказ уходит в accrual_dead_letters.
+	// 0 — без ограничения.
+	MaxFailures int
+}
+
+// Poller опрашивает системы расчёта начислений пулом из фиксированного числа воркеров.
+// Каждый заказ отправляется провайдеру, выбранному реестром по номеру заказа.
+type Poller struct {
+	providers *Registry
+	repo      Repository
+	workers   int
+	logger    *log.Logger
+
+	owner     string
+	lease     time.Duration
+	batchSize int
+	policy    Policy
+
+	maxAttempts int
+	maxAge      time.Duration
+	maxFailures int
+
+	// updates собирает ответы системы расчёта за раунд, чтобы записать их одной транзакцией.
+	mu      sync.Mutex
+	updates []domain.OrderUpdate
+}
+
+func NewPoller(cfg Config, providers *Registry, repo Repository, logger *log.Logger) *Poller {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	return &Poller{
+		providers: providers,
+		repo:      repo,
+		workers:   workers,
+		logger:    logger,
+
+		owner:     cfg.Owner,
+		lease:     cfg.Lease,
+		batchSize: cfg.BatchSize,
+		policy:    cfg.Policy,
+
+		maxAttempts: cfg.MaxAttempts,
+		maxAge:      cfg.MaxAge,
+		maxFailures: cfg.MaxFailures,
+	}
+}
+
+// Poll проводит один раунд опроса: захватывает заказы, срок проверки которых наступил,
+// проверяет их не более чем workers воркерами и записывает ответы одной транзакцией.
+// Раунды не должны перекрываться, чтобы один и тот же заказ не опрашивался параллельно;
+// это обеспечивает планировщик, который вызывает Poll.
+func (p *Poller) Poll(ctx context.Context) error {
+	orders, err := p.repo.GetOrderStatus(ctx, p.owner, p.lease, p.batchSize)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan domain.PendingOrder)
+	var workers sync.WaitGroup
+	for i := 0; i < min(p.workers, len(orders)); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for order := range jobs {
+				p.process(ctx, order)
+			}
+		}()
+	}
+
+loop:
+	for _, order := range orders {
+		select {
+		case jobs <- order:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	workers.Wait()
+
+	p.flush(context.WithoutCancel(ctx))
+	return nil
+}
+
+// flush записывает ответы, собранные за раунд.
+func (p *Poller) flush(ctx context.Context) {
+	p.mu.Lock()
+	updates := p.updates
+	p.updates = nil
+	p.mu.Unlock()
+
+	if len(updates) == 0 {
+		return
+	}
+
+	rejected, err := p.repo.UpdateOrders(ctx, p.owner, updates)
+	if err != nil {
+		p.logError(err)
+		if !errors.Is(err, domain.ErrInvalidPayload) {
+			// Сбой базы не связан с ответами: аренда заказов истечёт, и они будут проверены снова.
+			return
+		}
+
+		// Одна испорченная запись не должна задерживать весь раунд:
+		// записываем ответы по одному, чтобы найти и засчитать сбой только ей.
+		rejected = make(map[string]error)
+		for _, update := range updates {
+			failed, err := p.repo.UpdateOrders(ctx, p.owner, []domain.OrderUpdate{update})
+			if err != nil {
+				rejected[update.Order.OrderID] = err
+				continue
+			}
+			for orderID, err := range failed {
+				rejected[orderID] = err
+			}
+		}
+	}
+
+	for _, update := range updates {
+		err, ok := rejected[update.Order.OrderID]
+		if !ok {
+			continue
+		}
+		delete(rejected, update.Order.OrderID)
+
+		switch {
+		case errors.Is(err, domain.ErrStatusTransition):
+			p.logger.WithFields(log.Fields{
+				"worker": "accrual",
+				"order":  update.Order.OrderID,
+			}).Warn(err)
+		case errors.Is(err, domain.ErrOrderUnchanged):
+		case errors.Is(err, domain.ErrInvalidPayload), errors.Is(err, domain.ErrUnknownStatus):
+			// Сбой засчитывается, только если его вызвал сам ответ: такой ответ не запишется и при повторе.
+			p.fail(ctx, domain.OrderFailure{
+				OrderID:     update.Order.OrderID,
+				Error:       err.Error(),
+				Payload:     update.Order.Payload,
+				NextCheckAt: update.NextCheckAt,
+			})
+		default:
+			// Потеря аренды, удалённый заказ или временный сбой базы: заказ проверится снова, когда истечёт аренда.
+			p.logError(err)
+		}
+	}
+}
+
+// fail засчитывает заказу сбой обработки ответа системы расчёта.
+func (p *Poller) fail(ctx context.Context, failure domain.OrderFailure) {
+	fields := log.Fields{
+		"worker": "accrual",
+		"order":  failure.OrderID,
+	}
+	p.logger.WithFields(fields).Error(failure.Error)
+
+	deadLettered, err := p.repo.FailOrder(ctx, p.owner, failure, p.maxFailures)
+	if err != nil {
+		p.logError(err)
+		return
+	}
+	if deadLettered {
+		p.logger.WithFields(fields).Warn("order moved to accrual dead letters")
+	}
+}
+
+// process проверяет один заказ. Начатая проверка доводится до конца даже после отмены ctx,
+// чтобы не терять уже полученный ответ системы расчёта.
+func (p *Poller) process(ctx context.Context, pending domain.PendingOrder) {
+	provider := p.providers.Match(pending.OrderID)
+	if provider == nil || !provider.Polled() {
+		if provider == nil {
+			p.logger.WithFields(log.Fields{
+				"worker": "accrual",
+				"order":  pending.OrderID,
+			}).Warn("no accrual provider matches order")
+		}
+		p.postpone(context.WithoutCancel(ctx), pending)
+		return
+	}
+
+	if err := provider.throttle.Wait(ctx); err != nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	order, err := p.check(ctx, provider, pending.OrderID)
+	var payloadErr *PayloadError
+	if errors.As(err, &payloadErr) {
+		p.fail(ctx, domain.OrderFailure{
+			OrderID:     pending.OrderID,
+			Error:       err.Error(),
+			Payload:     payloadErr.Payload,
+			NextCheckAt: p.nextCheckAt(pending),
+		})
+		return
+	}
+	if errors.Is(err, ErrNotRegistered) && p.unregistered(pending) {
+		if err := p.repo.ExpireOrder(ctx, p.owner, pending.OrderID); err != nil {
+			p.logError(err)
+		}
+		return
+	}
+	if err != nil && !errors.Is(err, ErrNotRegistered) && !errors.Is(err, ErrCircuitOpen) {
+		p.logError(err)
+	}
+
+	// Проверкой считается только ответ системы расчёта о заказе. Разомкнутый автомат, 429 и сбои
+	// системы расчёта не приближают новый заказ к UNREGISTERED.
+	if order == nil {
+		if errors.Is(err, ErrNotRegistered) {
+			p.reschedule(ctx, pending)
+		} else {
+			p.postpone(ctx, pending)
+		}
+		return
+	}
+
+	p.mu.Lock()
+	p.updates = append(p.updates, domain.OrderUpdate{Order: *order, NextCheckAt: p.nextCheckAt(pending)})
+	p.mu.Unlock()
+}
+
+// reschedule откладывает заказ, о котором система расчёта ещё не знает, до следующей проверки.
+func (p *Poller) reschedule(ctx context.Context, pending domain.PendingOrder) {
+	if err := p.repo.RescheduleOrder(ctx, p.owner, pending.OrderID, p.nextCheckAt(pending)); err != nil {
+		p.logError(err)
+	}
+}
+
+// postpone откладывает заказ, по которому запрос не отправлялся или не получил ответа, не засчитывая проверку.
+func (p *Poller) postpone(ctx context.Context, pending domain.PendingOrder) {
+	if err := p.repo.PostponeOrder(ctx, p.owner, pending.OrderID, p.nextCheckAt(pending)); err != nil {
+		p.logError(err)
+	}
+}
+
+func (p *Poller) nextCheckAt(pending domain.PendingOrder) time.Time {
+	now := time.Now()
+	return now.Add(p.policy.Next(pending, now))
+}
+
+// unregistered сообщает, что система расчёта так и не узнала о новом заказе
+// за отведённое число проверок или время, и ждать её ответа больше не нужно.
+func (p *Poller) unregistered(pending domain.PendingOrder) bool {
+	if pending.Status != domain.NewOrder {
+		return false
+	}
+	if p.maxAttempts > 0 && pending.Attempts+1 >= p.maxAttempts {
+		return true
+	}
+	return p.maxAge > 0 && time.Since(pending.UploadedAt) >= p.maxAge
+}
+
+// check запрашивает расчёт по заказу. Возвращает nil, если расчёт получить не удалось.
+func (p *Poller) check(ctx context.Context, provider *Provider, orderID string) (*domain.ScoringSystem, error) {
+	order, err := provider.GetOrder(ctx, orderID)
+	if rateErr, ok := provider.throttle.handle(err); ok {
+		state := provider.throttle.State()
+		p.logger.WithFields(log.Fields{
+			"worker":       "accrual",
+			"provider":     provider.Name(),
+			"retry_after":  rateErr.RetryAfter,
+			"paused_until": state.PausedUntil.Format(time.RFC3339),
+			"rate_limit":   state.RateLimit,
+		}).Warn("accrual system throttled requests")
+		return nil, nil
+	}
+	return order, err
+}
+
+func (p *Poller) logError(err error) {
+	p.logger.WithFields(log.Fields{"worker": "accrual"}).Error(err)
+}
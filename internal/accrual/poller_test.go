@@ -0,0 +1,319 @@
+package accrual_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/accrual/accrualtest"
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/httpclient"
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeRepository хранит заказы в памяти и записывает, что с ними сделал опрос.
+type fakeRepository struct {
+	mu     sync.Mutex
+	orders map[string]*domain.PendingOrder
+	// broken — ошибки записи по заказам: пакет с таким заказом не записывается целиком.
+	broken map[string]error
+
+	updates     []domain.ScoringSystem
+	rescheduled []string
+	postponed   []string
+	expired     []string
+	failed      []string
+}
+
+func newFakeRepository(orderIDs ...string) *fakeRepository {
+	r := &fakeRepository{orders: make(map[string]*domain.PendingOrder), broken: make(map[string]error)}
+	for _, orderID := range orderIDs {
+		r.orders[orderID] = &domain.PendingOrder{OrderID: orderID, Status: domain.NewOrder, UploadedAt: time.Now()}
+	}
+	return r
+}
+
+func (r *fakeRepository) GetOrderStatus(ctx context.Context, owner string, lease time.Duration, limit int) ([]domain.PendingOrder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pending []domain.PendingOrder
+	for _, order := range r.orders {
+		if !order.Status.IsTerminal() && len(pending) < limit {
+			pending = append(pending, *order)
+		}
+	}
+	return pending, nil
+}
+
+func (r *fakeRepository) UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, update := range updates {
+		if err := r.broken[update.Order.OrderID]; err != nil {
+			return nil, err
+		}
+	}
+	for _, update := range updates {
+		status, err := domain.ParseAccrualStatus(update.Order.Status)
+		if err != nil {
+			return nil, err
+		}
+		r.updates = append(r.updates, update.Order)
+		r.orders[update.Order.OrderID].Status = status
+		r.orders[update.Order.OrderID].Attempts++
+	}
+	return nil, nil
+}
+
+func (r *fakeRepository) RescheduleOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rescheduled = append(r.rescheduled, orderID)
+	r.orders[orderID].Attempts++
+	return nil
+}
+
+func (r *fakeRepository) PostponeOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.postponed = append(r.postponed, orderID)
+	return nil
+}
+
+func (r *fakeRepository) ExpireOrder(ctx context.Context, owner string, orderID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expired = append(r.expired, orderID)
+	r.orders[orderID].Status = domain.Unregistered
+	return nil
+}
+
+func (r *fakeRepository) FailOrder(ctx context.Context, owner string, failure domain.OrderFailure, maxFailures int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = append(r.failed, failure.OrderID)
+	return false, nil
+}
+
+func (r *fakeRepository) status(orderID string) domain.PendingOrder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.orders[orderID]
+}
+
+// newTestPoller опрашивает server одним провайдером, автомат которого размыкается после breakerThreshold сбоев.
+func newTestPoller(t *testing.T, server *accrualtest.Server, repo accrual.Repository, breakerThreshold int) (*accrual.Poller, *accrual.Provider) {
+	t.Helper()
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	client := accrual.NewHTTPClient(server.URL, httpclient.New(httpclient.Config{
+		RequestTimeout: 5 * time.Second,
+		MaxBodySize:    1 << 20,
+	}))
+	provider := accrual.NewProvider(accrual.ProviderConfig{
+		Name:             t.Name(),
+		BreakerThreshold: breakerThreshold,
+		BreakerCooldown:  time.Hour,
+	}, client, logger)
+
+	poller := accrual.NewPoller(accrual.Config{
+		Workers:     2,
+		Owner:       "test",
+		Lease:       time.Minute,
+		BatchSize:   10,
+		Policy:      accrual.Policy{Backoff: accrual.Backoff{Base: time.Second, Max: time.Minute}},
+		MaxAttempts: 2,
+	}, accrual.NewRegistry(provider), repo, logger)
+	return poller, provider
+}
+
+func poll(t *testing.T, poller *accrual.Poller, rounds int) {
+	t.Helper()
+	for i := 0; i < rounds; i++ {
+		if err := poller.Poll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPollerLifecycle(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	sum := decimal.RequireFromString("729.98")
+	server.Script("100", accrualtest.Registered(), accrualtest.Processing(), accrualtest.Processed(sum))
+	server.Script("200", accrualtest.Invalid())
+
+	repo := newFakeRepository("100", "200")
+	poller, _ := newTestPoller(t, server, repo, 5)
+	poll(t, poller, 4)
+
+	var (
+		statuses []domain.OrderStatus
+		last     domain.ScoringSystem
+	)
+	for _, update := range repo.updates {
+		if update.OrderID == "100" {
+			statuses = append(statuses, update.Status)
+			last = update
+		}
+	}
+	want := []domain.OrderStatus{domain.Registered, domain.Processing, domain.Processed}
+	if len(statuses) != len(want) {
+		t.Fatalf("order 100 updates = %v, want %v", statuses, want)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("order 100 updates = %v, want %v", statuses, want)
+		}
+	}
+	if !last.Bonuses.Equal(sum) {
+		t.Errorf("order 100 accrual = %s, want %s", last.Bonuses, sum)
+	}
+	if last.Provider != t.Name() {
+		t.Errorf("provider = %q, want %q", last.Provider, t.Name())
+	}
+
+	if got := repo.status("100").Status; got != domain.Processed {
+		t.Errorf("order 100 status = %s, want %s", got, domain.Processed)
+	}
+	if got := repo.status("200").Status; got != domain.Invalid {
+		t.Errorf("order 200 status = %s, want %s", got, domain.Invalid)
+	}
+	if calls := server.Calls("100"); calls != 3 {
+		t.Errorf("order 100 polled %d times, want 3", calls)
+	}
+	if calls := server.Calls("200"); calls != 1 {
+		t.Errorf("order 200 polled %d times, want 1", calls)
+	}
+	if len(repo.rescheduled)+len(repo.postponed)+len(repo.failed) != 0 {
+		t.Errorf("unexpected rescheduled %v, postponed %v, failed %v", repo.rescheduled, repo.postponed, repo.failed)
+	}
+}
+
+func TestPollerNotRegistered(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+
+	repo := newFakeRepository("300")
+	poller, _ := newTestPoller(t, server, repo, 5)
+
+	poll(t, poller, 1)
+	if len(repo.rescheduled) != 1 || len(repo.expired) != 0 {
+		t.Fatalf("after first 204: rescheduled %v, expired %v", repo.rescheduled, repo.expired)
+	}
+
+	poll(t, poller, 1)
+	if len(repo.expired) != 1 || repo.status("300").Status != domain.Unregistered {
+		t.Errorf("after %d attempts: expired %v, status %s", 2, repo.expired, repo.status("300").Status)
+	}
+	if len(repo.updates) != 0 {
+		t.Errorf("unexpected updates %v", repo.updates)
+	}
+}
+
+func TestPollerTooManyRequests(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script("400", accrualtest.TooManyRequests(60, 10))
+
+	repo := newFakeRepository("400")
+	poller, provider := newTestPoller(t, server, repo, 5)
+
+	started := time.Now()
+	poll(t, poller, 1)
+
+	if len(repo.postponed) != 1 || len(repo.rescheduled) != 0 || len(repo.updates) != 0 {
+		t.Errorf("after 429: postponed %v, rescheduled %v, updates %v", repo.postponed, repo.rescheduled, repo.updates)
+	}
+	if attempts := repo.status("400").Attempts; attempts != 0 {
+		t.Errorf("attempts after 429 = %d, want 0", attempts)
+	}
+
+	status := provider.Status()
+	if status.Throttle.RateLimit != 10 {
+		t.Errorf("rate limit = %d, want 10", status.Throttle.RateLimit)
+	}
+	if status.Throttle.PausedUntil.Before(started.Add(59 * time.Second)) {
+		t.Errorf("paused until %s, want about a minute after %s", status.Throttle.PausedUntil, started)
+	}
+	if status.Breaker.State != accrual.BreakerClosed {
+		t.Errorf("breaker state = %s, want %s", status.Breaker.State, accrual.BreakerClosed)
+	}
+}
+
+func TestPollerServerError(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Default(accrualtest.InternalError())
+
+	repo := newFakeRepository("500")
+	poller, provider := newTestPoller(t, server, repo, 2)
+
+	poll(t, poller, 2)
+	if state := provider.Status().Breaker.State; state != accrual.BreakerOpen {
+		t.Fatalf("breaker state after 2 failures = %s, want %s", state, accrual.BreakerOpen)
+	}
+
+	poll(t, poller, 1)
+	if calls := server.Calls("500"); calls != 2 {
+		t.Errorf("order polled %d times with open breaker, want 2", calls)
+	}
+	if len(repo.postponed) != 3 || len(repo.rescheduled) != 0 {
+		t.Errorf("postponed %v, rescheduled %v, want 3 postponed", repo.postponed, repo.rescheduled)
+	}
+	if order := repo.status("500"); order.Attempts != 0 || order.Status != domain.NewOrder {
+		t.Errorf("order after outage = %+v, want NEW with 0 attempts", order)
+	}
+}
+
+// TestPollerFlushTransientError проверяет, что сбой базы при записи раунда не засчитывается заказам.
+func TestPollerFlushTransientError(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Default(accrualtest.Processed(decimal.NewFromInt(100)))
+
+	repo := newFakeRepository("600", "700")
+	repo.broken["600"] = errors.New("postgreSQL: updateOrders connection reset by peer")
+	poller, _ := newTestPoller(t, server, repo, 5)
+	poll(t, poller, 1)
+
+	if len(repo.failed) != 0 {
+		t.Errorf("failed %v after a transient error, want none", repo.failed)
+	}
+	if len(repo.updates) != 0 {
+		t.Errorf("updates %v, want none", repo.updates)
+	}
+}
+
+// TestPollerFlushInvalidPayload проверяет, что сбой засчитывается только заказу, ответ которого не записывается.
+func TestPollerFlushInvalidPayload(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Default(accrualtest.Processed(decimal.NewFromInt(100)))
+
+	repo := newFakeRepository("600", "700")
+	repo.broken["600"] = fmt.Errorf("%w: check constraint violated", domain.ErrInvalidPayload)
+	poller, _ := newTestPoller(t, server, repo, 5)
+	poll(t, poller, 1)
+
+	if len(repo.failed) != 1 || repo.failed[0] != "600" {
+		t.Errorf("failed %v, want [600]", repo.failed)
+	}
+	if got := repo.status("700").Status; got != domain.Processed {
+		t.Errorf("order 700 status = %s, want %s", got, domain.Processed)
+	}
+}
@@ -0,0 +1,165 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoProvider возвращается, если ни одна система расчёта не обслуживает заказ.
+var ErrNoProvider = errors.New("accrual: no provider matches order")
+
+// Rule выбирает заказы провайдера по номеру. Заказ подходит, если выполняются все заданные условия;
+// пустое правило подходит любому заказу.
+type Rule struct {
+	Prefix  string
+	Length  int
+	Pattern *regexp.Regexp
+}
+
+// NewRule собирает правило из настроек провайдера. Пустой pattern не проверяется.
+func NewRule(prefix string, length int, pattern string) (Rule, error) {
+	rule := Rule{Prefix: prefix, Length: length}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Pattern = re
+	}
+	return rule, nil
+}
+
+func (r Rule) Match(orderID string) bool {
+	if r.Prefix != "" && !strings.HasPrefix(orderID, r.Prefix) {
+		return false
+	}
+	if r.Length > 0 && len(orderID) != r.Length {
+		return false
+	}
+	return r.Pattern == nil || r.Pattern.MatchString(orderID)
+}
+
+// ProviderConfig — параметры одной системы расчёта начислений.
+type ProviderConfig struct {
+	Name string
+	Rule Rule
+	// Callback — провайдер сам присылает статусы, и опрашивать его не нужно.
+	Callback bool
+	// RateLimit — начальное ограничение запросов в минуту, 0 — без ограничения.
+	RateLimit        int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Provider — система расчёта начислений со своим ограничением запросов и автоматом защиты.
+type Provider struct {
+	name     string
+	rule     Rule
+	callback bool
+	client   Client
+	throttle *Throttle
+	breaker  *Breaker
+}
+
+// NewProvider оборачивает client автоматом провайдера. Для провайдера с Callback client может быть nil.
+func NewProvider(cfg ProviderConfig, client Client, logger *log.Logger) *Provider {
+	breaker := NewBreaker(cfg.Name, cfg.BreakerThreshold, cfg.BreakerCooldown, logger)
+	if client != nil {
+		client = WithBreaker(client, breaker)
+	}
+	return &Provider{
+		name:     cfg.Name,
+		rule:     cfg.Rule,
+		callback: cfg.Callback,
+		client:   client,
+		throttle: NewThrottle(cfg.Name, cfg.RateLimit),
+		breaker:  breaker,
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// Polled сообщает, нужно ли опрашивать провайдера.
+func (p *Provider) Polled() bool {
+	return !p.callback && p.client != nil
+}
+
+// GetOrder запрашивает расчёт по заказу и помечает ответ именем провайдера.
+func (p *Provider) GetOrder(ctx context.Context, orderID string) (*domain.ScoringSystem, error) {
+	order, err := p.client.GetOrder(ctx, orderID)
+	if order != nil {
+		order.Provider = p.name
+	}
+	return order, err
+}
+
+// ProviderStatus — состояние провайдера для health-проверки.
+type ProviderStatus struct {
+	Name     string        `json:"name"`
+	Callback bool          `json:"callback"`
+	Breaker  BreakerStatus `json:"breaker"`
+	Throttle ThrottleState `json:"throttle"`
+}
+
+func (p *Provider) Status() ProviderStatus {
+	return ProviderStatus{
+		Name:     p.name,
+		Callback: p.callback,
+		Breaker:  p.breaker.Status(),
+		Throttle: p.throttle.State(),
+	}
+}
+
+// Registry выбирает систему расчёта для заказа. Провайдеры проверяются в порядке регистрации,
+// заказ достаётся первому, чьё правило подходит к номеру.
+type Registry struct {
+	providers []*Provider
+}
+
+func NewRegistry(providers ...*Provider) *Registry {
+	return &Registry{
+		providers: providers,
+	}
+}
+
+// Match возвращает провайдера заказа или nil, если ни одно правило не подходит.
+func (r *Registry) Match(orderID string) *Provider {
+	for _, provider := range r.providers {
+		if provider.rule.Match(orderID) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// Check запрашивает расчёт по заказу у его провайдера вне очереди опроса, соблюдая ограничение запросов.
+// Провайдер, присылающий статусы сам, тоже опрашивается, если у него задан адрес.
+func (r *Registry) Check(ctx context.Context, orderID string) (*domain.ScoringSystem, string, error) {
+	provider := r.Match(orderID)
+	if provider == nil || provider.client == nil {
+		return nil, "", ErrNoProvider
+	}
+
+	if err := provider.throttle.Wait(ctx); err != nil {
+		return nil, provider.name, err
+	}
+	order, err := provider.GetOrder(ctx, orderID)
+	provider.throttle.handle(err)
+	return order, provider.name, err
+}
+
+func (r *Registry) Status() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(r.providers))
+	for _, provider := range r.providers {
+		statuses = append(statuses, provider.Status())
+	}
+	return statuses
+}
@@ -0,0 +1,88 @@
+package accrual_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		length  int
+		pattern string
+		orderID string
+		want    bool
+	}{
+		{"empty rule matches any order", "", 0, "", "12345678903", true},
+		{"prefix", "42", 0, "", "4200000000", true},
+		{"other prefix", "42", 0, "", "2400000000", false},
+		{"length", "", 10, "", "1234567890", true},
+		{"shorter order", "", 10, "", "123456789", false},
+		{"longer order", "", 10, "", "12345678901", false},
+		{"pattern", "", 0, `^\d{4}0$`, "12340", true},
+		{"pattern mismatch", "", 0, `^\d{4}0$`, "12341", false},
+		{"all conditions", "9", 5, `0$`, "91230", true},
+		{"prefix fails the rule", "9", 5, `0$`, "81230", false},
+		{"length fails the rule", "9", 5, `0$`, "912340", false},
+		{"pattern fails the rule", "9", 5, `0$`, "91231", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := accrual.NewRule(tt.prefix, tt.length, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.Match(tt.orderID); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.orderID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleInvalidPattern(t *testing.T) {
+	if _, err := accrual.NewRule("", 0, "("); err == nil {
+		t.Error("NewRule accepted an invalid pattern")
+	}
+}
+
+// TestRegistryMatch проверяет, что заказ достаётся первому подходящему провайдеру в порядке регистрации.
+func TestRegistryMatch(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	provider := func(name, prefix string) *accrual.Provider {
+		rule, err := accrual.NewRule(prefix, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accrual.NewProvider(accrual.ProviderConfig{Name: name, Rule: rule, Callback: true}, nil, logger)
+	}
+	registry := accrual.NewRegistry(provider("partner", "77"), provider("partner-vip", "777"), provider("legacy", "1"))
+
+	tests := []struct {
+		orderID string
+		want    string
+	}{
+		{"7712345", "partner"},
+		{"7772345", "partner"},
+		{"1234567", "legacy"},
+		{"2234567", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if p := registry.Match(tt.orderID); p != nil {
+			got = p.Name()
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.orderID, got, tt.want)
+		}
+	}
+
+	if p := registry.Match("7712345"); p.Polled() {
+		t.Error("callback provider without a client is polled")
+	}
+}
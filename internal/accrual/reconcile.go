@@ -0,0 +1,159 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReconcileRepository описывает хранилище, с которым сверяются расчёты систем расчёта.
+type ReconcileRepository interface {
+	GetProcessedOrders(ctx context.Context, after string, since time.Time, limit int) ([]domain.Order, error)
+	AddDiscrepancy(ctx context.Context, discrepancy domain.Discrepancy) error
+	ResolveDiscrepancy(ctx context.Context, orderID string) error
+	CorrectOrder(ctx context.Context, discrepancy domain.Discrepancy) error
+}
+
+// ReconcileConfig — параметры сверки.
+type ReconcileConfig struct {
+	BatchSize int
+	// Window ограничивает сверку заказами, загруженными за последнее время, 0 — все заказы.
+	Window time.Duration
+	// AutoCorrect исправляет заказы, по которым система расчёта вернула другой окончательный расчёт.
+	AutoCorrect bool
+}
+
+// Reconciler заново запрашивает расчёт по обработанным заказам и сравнивает его с сохранённым.
+type Reconciler struct {
+	providers *Registry
+	repo      ReconcileRepository
+	cfg       ReconcileConfig
+	logger    *log.Logger
+}
+
+func NewReconciler(cfg ReconcileConfig, providers *Registry, repo ReconcileRepository, logger *log.Logger) *Reconciler {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 100
+	}
+	return &Reconciler{
+		providers: providers,
+		repo:      repo,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// Run сверяет все заказы в статусе PROCESSED и записывает расхождения в отчёт. Расхождение,
+// которое больше не находится, закрывается.
+// Прерывается, если система расчёта недоступна и автомат разомкнут.
+func (r *Reconciler) Run(ctx context.Context) (domain.ReconcileReport, error) {
+	var report domain.ReconcileReport
+
+	var since time.Time
+	if r.cfg.Window > 0 {
+		since = time.Now().Add(-r.cfg.Window)
+	}
+
+	after := ""
+	for {
+		orders, err := r.repo.GetProcessedOrders(ctx, after, since, r.cfg.BatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, order := range orders {
+			if err := r.reconcile(ctx, order, &report); err != nil {
+				return report, err
+			}
+			after = order.OrderID
+		}
+
+		if len(orders) < r.cfg.BatchSize {
+			return report, nil
+		}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, order domain.Order, report *domain.ReconcileReport) error {
+	provider := r.providers.Match(order.OrderID)
+	if provider == nil || !provider.Polled() {
+		report.Skipped++
+		return nil
+	}
+
+	remote, err := r.fetch(ctx, provider, order.OrderID)
+	if err != nil && !errors.Is(err, ErrNotRegistered) {
+		if errors.Is(err, ErrCircuitOpen) || ctx.Err() != nil {
+			return err
+		}
+		r.logError(order.OrderID, err)
+		report.Skipped++
+		return nil
+	}
+	report.Checked++
+
+	discrepancy := domain.Discrepancy{
+		OrderID:       order.OrderID,
+		Provider:      provider.Name(),
+		StoredStatus:  order.Status,
+		StoredBonuses: order.Bonuses,
+	}
+	if remote != nil {
+		discrepancy.RemoteStatus = remote.Status
+		if status, err := domain.ParseAccrualStatus(remote.Status); err == nil {
+			discrepancy.RemoteStatus = status
+		}
+		discrepancy.RemoteBonuses = domain.NewAmount(remote.Bonuses)
+		discrepancy.Payload = remote.Payload
+	}
+	if discrepancy.RemoteStatus == order.Status && discrepancy.RemoteBonuses.Equal(order.Bonuses.Decimal) {
+		return r.repo.ResolveDiscrepancy(ctx, order.OrderID)
+	}
+	report.Discrepancies++
+
+	r.logger.WithFields(log.Fields{
+		"worker":         "reconcile",
+		"order":          order.OrderID,
+		"provider":       provider.Name(),
+		"stored_status":  order.Status,
+		"stored_accrual": order.Bonuses.String(),
+		"remote_status":  discrepancy.RemoteStatus,
+		"remote_accrual": discrepancy.RemoteBonuses.String(),
+	}).Warn("accrual discrepancy found")
+
+	if r.cfg.AutoCorrect && discrepancy.Correctable() {
+		err := r.repo.CorrectOrder(ctx, discrepancy)
+		if err == nil {
+			report.Corrected++
+			return nil
+		}
+		// Неисправленное расхождение, в том числе отклонённое из-за баланса, остаётся в отчёте.
+		r.logError(order.OrderID, err)
+	}
+
+	if err := r.repo.AddDiscrepancy(ctx, discrepancy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fetch запрашивает расчёт, соблюдая ограничение запросов провайдера, и повторяет запрос после 429.
+func (r *Reconciler) fetch(ctx context.Context, provider *Provider, orderID string) (*domain.ScoringSystem, error) {
+	for {
+		if err := provider.throttle.Wait(ctx); err != nil {
+			return nil, err
+		}
+		order, err := provider.GetOrder(ctx, orderID)
+		if _, ok := provider.throttle.handle(err); ok {
+			continue
+		}
+		return order, err
+	}
+}
+
+func (r *Reconciler) logError(orderID string, err error) {
+	r.logger.WithFields(log.Fields{"worker": "reconcile", "order": orderID}).Error(err)
+}
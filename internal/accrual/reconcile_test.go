@@ -0,0 +1,157 @@
+package accrual_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/accrual/accrualtest"
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/httpclient"
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeReconcileRepository хранит обработанные заказы в памяти и записывает итоги сверки.
+type fakeReconcileRepository struct {
+	orders []domain.Order
+	// reject — ошибка, с которой отклоняется исправление заказа.
+	reject error
+
+	discrepancies []domain.Discrepancy
+	corrected     []domain.Discrepancy
+	resolved      []string
+}
+
+func (r *fakeReconcileRepository) GetProcessedOrders(ctx context.Context, after string, since time.Time, limit int) ([]domain.Order, error) {
+	var orders []domain.Order
+	for _, order := range r.orders {
+		if order.OrderID > after && len(orders) < limit {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *fakeReconcileRepository) AddDiscrepancy(ctx context.Context, discrepancy domain.Discrepancy) error {
+	r.discrepancies = append(r.discrepancies, discrepancy)
+	return nil
+}
+
+func (r *fakeReconcileRepository) ResolveDiscrepancy(ctx context.Context, orderID string) error {
+	r.resolved = append(r.resolved, orderID)
+	return nil
+}
+
+func (r *fakeReconcileRepository) CorrectOrder(ctx context.Context, discrepancy domain.Discrepancy) error {
+	if r.reject != nil {
+		return r.reject
+	}
+	r.corrected = append(r.corrected, discrepancy)
+	return nil
+}
+
+func newTestReconciler(server *accrualtest.Server, repo accrual.ReconcileRepository, autoCorrect bool) *accrual.Reconciler {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	client := accrual.NewHTTPClient(server.URL, httpclient.New(httpclient.Config{
+		RequestTimeout: 5 * time.Second,
+		MaxBodySize:    1 << 20,
+	}))
+	provider := accrual.NewProvider(accrual.ProviderConfig{Name: "reconcile"}, client, logger)
+	return accrual.NewReconciler(accrual.ReconcileConfig{BatchSize: 2, AutoCorrect: autoCorrect},
+		accrual.NewRegistry(provider), repo, logger)
+}
+
+func processed(orderID string, bonuses int64) domain.Order {
+	return domain.Order{OrderID: orderID, Status: domain.Processed, Bonuses: domain.NewAmount(decimal.NewFromInt(bonuses))}
+}
+
+func TestReconcilerReport(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script("100", accrualtest.Processed(decimal.NewFromInt(100)))
+	server.Script("200", accrualtest.Processed(decimal.NewFromInt(50)))
+	server.Script("300", accrualtest.Invalid())
+	server.Script("400", accrualtest.NoContent())
+	server.Script("500", accrualtest.InternalError())
+
+	repo := &fakeReconcileRepository{orders: []domain.Order{
+		processed("100", 100), processed("200", 100), processed("300", 100), processed("400", 100), processed("500", 100),
+	}}
+	report, err := newTestReconciler(server, repo, false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := domain.ReconcileReport{Checked: 4, Discrepancies: 3, Skipped: 1}
+	if report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	if len(repo.resolved) != 1 || repo.resolved[0] != "100" {
+		t.Errorf("resolved %v, want [100]", repo.resolved)
+	}
+	if len(repo.corrected) != 0 {
+		t.Errorf("corrected %v without auto-correction", repo.corrected)
+	}
+
+	var got []string
+	for _, d := range repo.discrepancies {
+		got = append(got, d.OrderID+":"+string(d.RemoteStatus))
+	}
+	wantDiscrepancies := []string{"200:PROCESSED", "300:INVALID", "400:"}
+	if len(got) != len(wantDiscrepancies) {
+		t.Fatalf("discrepancies = %v, want %v", got, wantDiscrepancies)
+	}
+	for i := range got {
+		if got[i] != wantDiscrepancies[i] {
+			t.Errorf("discrepancies = %v, want %v", got, wantDiscrepancies)
+			break
+		}
+	}
+}
+
+func TestReconcilerAutoCorrect(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script("200", accrualtest.Processed(decimal.NewFromInt(50)))
+	server.Script("300", accrualtest.Invalid())
+	server.Script("400", accrualtest.NoContent())
+
+	repo := &fakeReconcileRepository{orders: []domain.Order{processed("200", 100), processed("300", 100), processed("400", 100)}}
+	report, err := newTestReconciler(server, repo, true).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Corrected != 2 || report.Discrepancies != 3 {
+		t.Errorf("report = %+v, want 3 discrepancies and 2 corrected", report)
+	}
+	// Заказ, о котором система расчёта не знает, не исправляется и остаётся в отчёте.
+	if len(repo.discrepancies) != 1 || repo.discrepancies[0].OrderID != "400" {
+		t.Errorf("discrepancies = %+v, want only 400", repo.discrepancies)
+	}
+}
+
+// TestReconcilerNegativeCorrection проверяет, что отклонённое из-за баланса исправление остаётся в отчёте.
+func TestReconcilerNegativeCorrection(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script("300", accrualtest.Invalid())
+
+	repo := &fakeReconcileRepository{orders: []domain.Order{processed("300", 100)}, reject: domain.ErrNegativeCorrection}
+	report, err := newTestReconciler(server, repo, true).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Corrected != 0 || report.Discrepancies != 1 {
+		t.Errorf("report = %+v, want 1 uncorrected discrepancy", report)
+	}
+	if len(repo.discrepancies) != 1 || repo.discrepancies[0].Corrected {
+		t.Errorf("discrepancies = %+v, want one uncorrected", repo.discrepancies)
+	}
+}
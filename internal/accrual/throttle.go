@@ -0,0 +1,166 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter используется, если система расчёта не прислала заголовок Retry-After.
+const defaultRetryAfter = time.Minute
+
+var rateLimitPattern = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// RateLimitError возвращается, когда система расчёта ответила 429 Too Many Requests.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	// Limit — допустимое число запросов в минуту из тела ответа, 0 если его не удалось разобрать.
+	Limit int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual: too many requests, retry after %s", e.RetryAfter)
+}
+
+func newRateLimitError(header http.Header, body []byte) *RateLimitError {
+	err := &RateLimitError{RetryAfter: parseRetryAfter(header.Get("Retry-After"))}
+	if m := rateLimitPattern.FindSubmatch(body); m != nil {
+		if limit, convErr := strconv.Atoi(string(m[1])); convErr == nil {
+			err.Limit = limit
+		}
+	}
+	return err
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+// ThrottleState — текущее состояние ограничения запросов к системе расчёта.
+type ThrottleState struct {
+	PausedUntil time.Time `json:"paused_until"`
+	RateLimit   int       `json:"rate_limit"`
+}
+
+// Throttle ограничивает частоту запросов к одной системе расчёта и приостанавливает их
+// после ответа 429. Общий для всех воркеров.
+type Throttle struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+	limit       int
+	next        time.Time
+
+	metrics           *expvar.Map
+	metricRateLimit   *expvar.Int
+	metricPausedUntil *expvar.String
+}
+
+// NewThrottle создаёт ограничитель провайдера name на limit запросов в минуту, 0 — без ограничения.
+func NewThrottle(name string, limit int) *Throttle {
+	t := &Throttle{
+		metrics:           providerMetrics(name),
+		metricRateLimit:   new(expvar.Int),
+		metricPausedUntil: new(expvar.String),
+	}
+	t.metrics.Set("throttle_rate_limit", t.metricRateLimit)
+	t.metrics.Set("throttle_paused_until", t.metricPausedUntil)
+	t.metrics.Add("throttle_pauses_total", 0)
+	t.SetLimit(limit)
+	return t
+}
+
+// Wait блокирует до момента, когда можно отправить очередной запрос.
+func (t *Throttle) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		until := t.pausedUntil
+		if t.next.After(until) {
+			until = t.next
+		}
+		if !until.After(now) {
+			if t.limit > 0 {
+				t.next = now.Add(time.Minute / time.Duration(t.limit))
+			}
+			t.mu.Unlock()
+			return nil
+		}
+		t.mu.Unlock()
+
+		timer := time.NewTimer(until.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Pause приостанавливает все запросы на d.
+func (t *Throttle) Pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+		t.metricPausedUntil.Set(until.Format(time.RFC3339))
+	}
+	t.metrics.Add("throttle_pauses_total", 1)
+}
+
+// SetLimit меняет допустимое число запросов в минуту, 0 — без ограничения.
+func (t *Throttle) SetLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limit = limit
+	t.metricRateLimit.Set(int64(limit))
+}
+
+func (t *Throttle) State() ThrottleState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ThrottleState{
+		PausedUntil: t.pausedUntil,
+		RateLimit:   t.limit,
+	}
+}
+
+// handle применяет к ограничителю ответ 429. Возвращает false, если err не связана с 429.
+func (t *Throttle) handle(err error) (*RateLimitError, bool) {
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		return nil, false
+	}
+
+	t.Pause(rateErr.RetryAfter)
+	if rateErr.Limit > 0 {
+		t.SetLimit(rateErr.Limit)
+	}
+	return rateErr, true
+}
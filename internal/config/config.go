@@ -15,6 +15,65 @@ type Config struct {
 	ScoringSystemPort string
 	TokenTTL          time.Duration
 	LogLevel          string
+	// ShutdownTimeout ограничивает время на завершение запросов и воркеров после сигнала остановки.
+	ShutdownTimeout time.Duration
+
+	AccrualWorkers      int
+	AccrualPollInterval time.Duration
+	AccrualRateLimit    int
+	AccrualLease        time.Duration
+	AccrualBatchSize    int
+	AccrualBackoffBase  time.Duration
+	AccrualBackoffMax   time.Duration
+	// Заказы старше AccrualFreshAge проверяются в AccrualAgedFactor раз реже свежих, но не реже раза в AccrualBackoffMax.
+	AccrualFreshAge   time.Duration
+	AccrualAgedFactor int
+	// AccrualMaxAttempts и AccrualMaxAge ограничивают ожидание регистрации заказа в системе расчёта, 0 — без ограничения.
+	AccrualMaxAttempts int
+	AccrualMaxAge      time.Duration
+	// AccrualMaxFailures сбоев обработки ответа переводят заказ в accrual_dead_letters, 0 — без ограничения.
+	AccrualMaxFailures int
+	// AccrualBreakerThreshold сбоев подряд размыкают автомат на AccrualBreakerCooldown.
+	AccrualBreakerThreshold int
+	AccrualBreakerCooldown  time.Duration
+	// Параметры исходящих HTTP-запросов к системе расчёта.
+	AccrualRequestTimeout  time.Duration
+	AccrualDialTimeout     time.Duration
+	AccrualKeepAlive       time.Duration
+	AccrualIdleConnTimeout time.Duration
+	AccrualMaxIdleConns    int
+	AccrualMaxConns        int
+	// AccrualMaxBodySize ограничивает размер тела ответа системы расчёта в байтах.
+	AccrualMaxBodySize int64
+	// AccrualPolling отключается, если система расчёта сама присылает статусы на /internal/accrual/callback.
+	AccrualPolling bool
+	// AccrualCallbackSecret — общий секрет для подписи callback-запросов, пустой отключает приём callback.
+	// Секреты задаются только окружением, см. LoadSecrets.
+	AccrualCallbackSecret string
+	// AccrualProvidersFile — JSON-файл с реестром систем расчёта партнёров, см. AccrualProvider.
+	AccrualProvidersFile string
+	// AccrualReconcileSchedule — расписание сверки обработанных заказов: cron-выражение или "@every <интервал>", пустое отключает сверку.
+	AccrualReconcileSchedule string
+	// AccrualReconcileWindow ограничивает сверку недавно загруженными заказами, 0 — все заказы.
+	AccrualReconcileWindow time.Duration
+	// AccrualReconcileFix исправляет заказы по окончательному расчёту из системы расчёта.
+	AccrualReconcileFix bool
+	// Reconcile запускает однократную сверку вместо сервера.
+	Reconcile bool
+	// RepairBalances пересчитывает балансы пользователей по журналу баллов вместо запуска сервера.
+	RepairBalances bool
+
+	// AdminToken открывает доступ к /api/admin, пустой отключает администрирование.
+	AdminToken string
+	// MerchantSecret — общий секрет для подписи запросов интеграций магазинов, пустой отключает /api/merchant.
+	// Секрет один на все магазины, а списания не привязаны к магазину, поэтому любой владелец секрета
+	// может отменить любое списание: выдавать его можно только доверенным интеграциям.
+	MerchantSecret string
+
+	// InstanceID отличает экземпляры сервиса, одновременно опрашивающие систему расчёта.
+	InstanceID string
+	// LeaderRenewInterval — как часто экземпляры борются за лидерство в задачах-одиночках.
+	LeaderRenewInterval time.Duration
 }
 
 func NewConfig() *Config {
@@ -22,9 +81,49 @@ func NewConfig() *Config {
 		Port:     ":8080",
 		TokenTTL: time.Minute * 30,
 		LogLevel: "debug",
+
+		ShutdownTimeout: time.Second * 10,
+
+		AccrualWorkers:      4,
+		AccrualPollInterval: time.Millisecond * 100,
+		AccrualLease:        time.Second * 30,
+		AccrualBatchSize:    15,
+		AccrualBackoffBase:  time.Second,
+		AccrualBackoffMax:   time.Minute * 10,
+		AccrualFreshAge:     time.Hour,
+		AccrualAgedFactor:   3,
+		AccrualMaxAttempts:  50,
+		AccrualMaxAge:       time.Hour * 24 * 7,
+		AccrualMaxFailures:  5,
+		AccrualPolling:      true,
+
+		AccrualBreakerThreshold: 5,
+		AccrualBreakerCooldown:  time.Second * 30,
+
+		AccrualRequestTimeout:  time.Second * 5,
+		AccrualDialTimeout:     time.Second * 3,
+		AccrualKeepAlive:       time.Second * 30,
+		AccrualIdleConnTimeout: time.Second * 90,
+		AccrualMaxIdleConns:    16,
+		AccrualMaxConns:        32,
+		AccrualMaxBodySize:     1 << 20,
+
+		AccrualReconcileSchedule: "0 3 * * *",
+		AccrualReconcileWindow:   time.Hour * 24 * 30,
+
+		InstanceID:          defaultInstanceID(),
+		LeaderRenewInterval: time.Second * 5,
 	}
 }
 
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
 type NetAddr struct {
 	Host string
 	Port int
@@ -55,6 +154,37 @@ func (c *Config) ParseFlags() {
 	flag.Var(port, "a", "net address host:port")
 	dbPort := flag.String("d", "", "port for database")
 	scoringSystemPort := flag.String("r", "", "port for scoring system")
+	flag.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "max time to drain requests and workers on shutdown")
+	flag.IntVar(&c.AccrualWorkers, "accrual-workers", c.AccrualWorkers, "number of accrual system workers")
+	flag.DurationVar(&c.AccrualPollInterval, "accrual-poll-interval", c.AccrualPollInterval, "interval between accrual system polling rounds")
+	flag.DurationVar(&c.AccrualLease, "accrual-lease", c.AccrualLease, "how long an order stays claimed by one instance")
+	flag.IntVar(&c.AccrualBatchSize, "accrual-batch-size", c.AccrualBatchSize, "number of orders claimed per polling round")
+	flag.DurationVar(&c.AccrualBackoffBase, "accrual-backoff-base", c.AccrualBackoffBase, "delay before the second check of an order")
+	flag.DurationVar(&c.AccrualBackoffMax, "accrual-backoff-max", c.AccrualBackoffMax, "max delay between checks of an order")
+	flag.DurationVar(&c.AccrualFreshAge, "accrual-fresh-age", c.AccrualFreshAge, "age up to which an order is polled on the regular schedule, 0 for any age")
+	flag.IntVar(&c.AccrualAgedFactor, "accrual-aged-factor", c.AccrualAgedFactor, "how many times less often orders older than the fresh age are polled")
+	flag.IntVar(&c.AccrualMaxAttempts, "accrual-max-attempts", c.AccrualMaxAttempts, "checks before an order unknown to the accrual system becomes UNREGISTERED, 0 for unlimited")
+	flag.DurationVar(&c.AccrualMaxAge, "accrual-max-age", c.AccrualMaxAge, "age after which an order unknown to the accrual system becomes UNREGISTERED, 0 for unlimited")
+	flag.IntVar(&c.AccrualMaxFailures, "accrual-max-failures", c.AccrualMaxFailures, "processing failures before an order is moved to dead letters, 0 for unlimited")
+	flag.IntVar(&c.AccrualBreakerThreshold, "accrual-breaker-threshold", c.AccrualBreakerThreshold, "consecutive accrual failures that open the circuit breaker")
+	flag.DurationVar(&c.AccrualBreakerCooldown, "accrual-breaker-cooldown", c.AccrualBreakerCooldown, "how long the accrual circuit breaker stays open")
+	flag.DurationVar(&c.AccrualRequestTimeout, "accrual-request-timeout", c.AccrualRequestTimeout, "timeout of a single accrual system request")
+	flag.DurationVar(&c.AccrualDialTimeout, "accrual-dial-timeout", c.AccrualDialTimeout, "timeout for connecting to the accrual system")
+	flag.DurationVar(&c.AccrualKeepAlive, "accrual-keep-alive", c.AccrualKeepAlive, "TCP keep-alive probe period for accrual connections, negative disables probes")
+	flag.DurationVar(&c.AccrualIdleConnTimeout, "accrual-idle-conn-timeout", c.AccrualIdleConnTimeout, "how long an idle accrual connection is kept in the pool")
+	flag.IntVar(&c.AccrualMaxIdleConns, "accrual-max-idle-conns", c.AccrualMaxIdleConns, "max idle connections to the accrual system")
+	flag.IntVar(&c.AccrualMaxConns, "accrual-max-conns", c.AccrualMaxConns, "max connections to the accrual system, 0 for unlimited")
+	flag.Int64Var(&c.AccrualMaxBodySize, "accrual-max-body-size", c.AccrualMaxBodySize, "max accrual system response body size in bytes")
+	flag.BoolVar(&c.AccrualPolling, "accrual-polling", c.AccrualPolling, "poll the accrual system for order statuses")
+	flag.StringVar(&c.AccrualProvidersFile, "accrual-providers", c.AccrualProvidersFile, "path to a JSON registry of accrual providers")
+	flag.StringVar(&c.AccrualReconcileSchedule, "accrual-reconcile-schedule", c.AccrualReconcileSchedule, "cron or @every schedule of accrual reconciliation, empty to disable")
+	flag.DurationVar(&c.AccrualReconcileWindow, "accrual-reconcile-window", c.AccrualReconcileWindow, "reconcile orders uploaded within this window, 0 for all orders")
+	flag.BoolVar(&c.AccrualReconcileFix, "accrual-reconcile-fix", c.AccrualReconcileFix, "correct orders that differ from the accrual system's final result")
+	flag.BoolVar(&c.Reconcile, "reconcile", c.Reconcile, "run accrual reconciliation once and exit")
+	flag.BoolVar(&c.RepairBalances, "repair-balances", c.RepairBalances, "recompute user balances from the points ledger and exit")
+	flag.StringVar(&c.InstanceID, "instance-id", c.InstanceID, "unique id of this service instance")
+	flag.DurationVar(&c.LeaderRenewInterval, "leader-renew-interval", c.LeaderRenewInterval, "how often singleton job leadership is renewed or contested")
+	flag.IntVar(&c.AccrualRateLimit, "accrual-rate-limit", c.AccrualRateLimit, "max accrual system requests per minute, 0 for unlimited")
 
 	flag.Parse()
 	c.DBPort = *dbPort
@@ -76,4 +206,172 @@ func (c *Config) ParseFlags() {
 		c.ScoringSystemPort = envScoring
 	}
 
+	if envShutdown := os.Getenv("SHUTDOWN_TIMEOUT"); envShutdown != "" {
+		if timeout, err := time.ParseDuration(envShutdown); err == nil {
+			c.ShutdownTimeout = timeout
+		}
+	}
+
+	if envWorkers := os.Getenv("ACCRUAL_WORKERS"); envWorkers != "" {
+		if workers, err := strconv.Atoi(envWorkers); err == nil {
+			c.AccrualWorkers = workers
+		}
+	}
+
+	if envInterval := os.Getenv("ACCRUAL_POLL_INTERVAL"); envInterval != "" {
+		if interval, err := time.ParseDuration(envInterval); err == nil {
+			c.AccrualPollInterval = interval
+		}
+	}
+
+	if envRateLimit := os.Getenv("ACCRUAL_RATE_LIMIT"); envRateLimit != "" {
+		if limit, err := strconv.Atoi(envRateLimit); err == nil {
+			c.AccrualRateLimit = limit
+		}
+	}
+
+	if envLease := os.Getenv("ACCRUAL_LEASE"); envLease != "" {
+		if lease, err := time.ParseDuration(envLease); err == nil {
+			c.AccrualLease = lease
+		}
+	}
+
+	if envBatch := os.Getenv("ACCRUAL_BATCH_SIZE"); envBatch != "" {
+		if batch, err := strconv.Atoi(envBatch); err == nil {
+			c.AccrualBatchSize = batch
+		}
+	}
+
+	if envBackoffBase := os.Getenv("ACCRUAL_BACKOFF_BASE"); envBackoffBase != "" {
+		if base, err := time.ParseDuration(envBackoffBase); err == nil {
+			c.AccrualBackoffBase = base
+		}
+	}
+
+	if envBackoffMax := os.Getenv("ACCRUAL_BACKOFF_MAX"); envBackoffMax != "" {
+		if backoffMax, err := time.ParseDuration(envBackoffMax); err == nil {
+			c.AccrualBackoffMax = backoffMax
+		}
+	}
+
+	if envFreshAge := os.Getenv("ACCRUAL_FRESH_AGE"); envFreshAge != "" {
+		if age, err := time.ParseDuration(envFreshAge); err == nil {
+			c.AccrualFreshAge = age
+		}
+	}
+
+	if envAgedFactor := os.Getenv("ACCRUAL_AGED_FACTOR"); envAgedFactor != "" {
+		if factor, err := strconv.Atoi(envAgedFactor); err == nil {
+			c.AccrualAgedFactor = factor
+		}
+	}
+
+	if envMaxAttempts := os.Getenv("ACCRUAL_MAX_ATTEMPTS"); envMaxAttempts != "" {
+		if attempts, err := strconv.Atoi(envMaxAttempts); err == nil {
+			c.AccrualMaxAttempts = attempts
+		}
+	}
+
+	if envMaxAge := os.Getenv("ACCRUAL_MAX_AGE"); envMaxAge != "" {
+		if age, err := time.ParseDuration(envMaxAge); err == nil {
+			c.AccrualMaxAge = age
+		}
+	}
+
+	if envMaxFailures := os.Getenv("ACCRUAL_MAX_FAILURES"); envMaxFailures != "" {
+		if failures, err := strconv.Atoi(envMaxFailures); err == nil {
+			c.AccrualMaxFailures = failures
+		}
+	}
+
+	if envThreshold := os.Getenv("ACCRUAL_BREAKER_THRESHOLD"); envThreshold != "" {
+		if threshold, err := strconv.Atoi(envThreshold); err == nil {
+			c.AccrualBreakerThreshold = threshold
+		}
+	}
+
+	if envCooldown := os.Getenv("ACCRUAL_BREAKER_COOLDOWN"); envCooldown != "" {
+		if cooldown, err := time.ParseDuration(envCooldown); err == nil {
+			c.AccrualBreakerCooldown = cooldown
+		}
+	}
+
+	if envTimeout := os.Getenv("ACCRUAL_REQUEST_TIMEOUT"); envTimeout != "" {
+		if timeout, err := time.ParseDuration(envTimeout); err == nil {
+			c.AccrualRequestTimeout = timeout
+		}
+	}
+
+	if envDial := os.Getenv("ACCRUAL_DIAL_TIMEOUT"); envDial != "" {
+		if timeout, err := time.ParseDuration(envDial); err == nil {
+			c.AccrualDialTimeout = timeout
+		}
+	}
+
+	if envKeepAlive := os.Getenv("ACCRUAL_KEEP_ALIVE"); envKeepAlive != "" {
+		if keepAlive, err := time.ParseDuration(envKeepAlive); err == nil {
+			c.AccrualKeepAlive = keepAlive
+		}
+	}
+
+	if envIdle := os.Getenv("ACCRUAL_IDLE_CONN_TIMEOUT"); envIdle != "" {
+		if timeout, err := time.ParseDuration(envIdle); err == nil {
+			c.AccrualIdleConnTimeout = timeout
+		}
+	}
+
+	if envIdleConns := os.Getenv("ACCRUAL_MAX_IDLE_CONNS"); envIdleConns != "" {
+		if conns, err := strconv.Atoi(envIdleConns); err == nil {
+			c.AccrualMaxIdleConns = conns
+		}
+	}
+
+	if envConns := os.Getenv("ACCRUAL_MAX_CONNS"); envConns != "" {
+		if conns, err := strconv.Atoi(envConns); err == nil {
+			c.AccrualMaxConns = conns
+		}
+	}
+
+	if envBodySize := os.Getenv("ACCRUAL_MAX_BODY_SIZE"); envBodySize != "" {
+		if size, err := strconv.ParseInt(envBodySize, 10, 64); err == nil {
+			c.AccrualMaxBodySize = size
+		}
+	}
+
+	if envPolling := os.Getenv("ACCRUAL_POLLING"); envPolling != "" {
+		if polling, err := strconv.ParseBool(envPolling); err == nil {
+			c.AccrualPolling = polling
+		}
+	}
+
+	if envProviders := os.Getenv("ACCRUAL_PROVIDERS"); envProviders != "" {
+		c.AccrualProvidersFile = envProviders
+	}
+
+	if envSchedule, ok := os.LookupEnv("ACCRUAL_RECONCILE_SCHEDULE"); ok {
+		c.AccrualReconcileSchedule = envSchedule
+	}
+
+	if envWindow := os.Getenv("ACCRUAL_RECONCILE_WINDOW"); envWindow != "" {
+		if window, err := time.ParseDuration(envWindow); err == nil {
+			c.AccrualReconcileWindow = window
+		}
+	}
+
+	if envFix := os.Getenv("ACCRUAL_RECONCILE_FIX"); envFix != "" {
+		if fix, err := strconv.ParseBool(envFix); err == nil {
+			c.AccrualReconcileFix = fix
+		}
+	}
+
+	if envInstance := os.Getenv("INSTANCE_ID"); envInstance != "" {
+		c.InstanceID = envInstance
+	}
+
+	if envRenew := os.Getenv("LEADER_RENEW_INTERVAL"); envRenew != "" {
+		if renew, err := time.ParseDuration(envRenew); err == nil {
+			c.LeaderRenewInterval = renew
+		}
+	}
+
 }
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultAccrualProvider — имя системы расчёта, заданной через -r или ACCRUAL_SYSTEM_ADDRESS.
+const DefaultAccrualProvider = "default"
+
+// AccrualProvider описывает одну систему расчёта начислений и заказы, которые она обслуживает.
+// Заказ относится к провайдеру, если его номер удовлетворяет всем заданным условиям
+// Prefix, Length и Pattern; провайдер без условий обслуживает любой заказ.
+type AccrualProvider struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// RateLimit — ограничение запросов в минуту, 0 — без ограничения.
+	RateLimit int    `json:"rate_limit"`
+	Prefix    string `json:"prefix"`
+	Length    int    `json:"length"`
+	Pattern   string `json:"pattern"`
+	// Callback — провайдер сам присылает статусы на /internal/accrual/callback и не опрашивается.
+	Callback bool `json:"callback"`
+}
+
+// AccrualProviders читает реестр из AccrualProvidersFile и добавляет в конец провайдер по умолчанию
+// из ScoringSystemPort. Провайдеры проверяются по порядку, заказ достаётся первому подходящему.
+func (c *Config) AccrualProviders() ([]AccrualProvider, error) {
+	var providers []AccrualProvider
+	if c.AccrualProvidersFile != "" {
+		data, err := os.ReadFile(c.AccrualProvidersFile)
+		if err != nil {
+			return nil, fmt.Errorf("accrual providers: %w", err)
+		}
+		if err := json.Unmarshal(data, &providers); err != nil {
+			return nil, fmt.Errorf("accrual providers: %w", err)
+		}
+	}
+
+	if c.ScoringSystemPort != "" {
+		providers = append(providers, AccrualProvider{
+			Name:      DefaultAccrualProvider,
+			URL:       c.ScoringSystemPort,
+			RateLimit: c.AccrualRateLimit,
+		})
+	}
+
+	names := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		if provider.Name == "" {
+			return nil, errors.New("accrual providers: provider name is required")
+		}
+		if names[provider.Name] {
+			return nil, fmt.Errorf("accrual providers: duplicate provider %q", provider.Name)
+		}
+		if provider.URL == "" && !provider.Callback {
+			return nil, fmt.Errorf("accrual providers: provider %q has no url", provider.Name)
+		}
+		names[provider.Name] = true
+	}
+	return providers, nil
+}
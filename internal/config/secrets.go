@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadSecrets читает секреты из переменных окружения. Вместо значения можно передать путь
+// к файлу в переменной с суффиксом _FILE. Секреты не принимаются флагами, чтобы они не попадали
+// в аргументы командной строки процесса.
+func (c *Config) LoadSecrets() error {
+	secrets := []struct {
+		env   string
+		value *string
+	}{
+		{"ACCRUAL_CALLBACK_SECRET", &c.AccrualCallbackSecret},
+		{"ADMIN_TOKEN", &c.AdminToken},
+		{"MERCHANT_SECRET", &c.MerchantSecret},
+	}
+
+	for _, secret := range secrets {
+		value, err := lookupSecret(secret.env)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*secret.value = value
+		}
+	}
+	return nil
+}
+
+// lookupSecret возвращает значение переменной env или содержимое файла из env_FILE без завершающих пробелов.
+func lookupSecret(env string) (string, error) {
+	if value := os.Getenv(env); value != "" {
+		return value, nil
+	}
+
+	path := os.Getenv(env + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", env, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSecrets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "merchant")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ADMIN_TOKEN", "from-env")
+	t.Setenv("MERCHANT_SECRET_FILE", file)
+	t.Setenv("ACCRUAL_CALLBACK_SECRET", "")
+
+	c := NewConfig()
+	if err := c.LoadSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if c.AdminToken != "from-env" || c.MerchantSecret != "from-file" || c.AccrualCallbackSecret != "" {
+		t.Errorf("secrets = %q, %q, %q", c.AdminToken, c.MerchantSecret, c.AccrualCallbackSecret)
+	}
+
+	t.Setenv("ACCRUAL_CALLBACK_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	if err := NewConfig().LoadSecrets(); err == nil {
+		t.Error("LoadSecrets with a missing secret file succeeded")
+	}
+}
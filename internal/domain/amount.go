@@ -0,0 +1,17 @@
+package domain
+
+import "github.com/shopspring/decimal"
+
+// Amount — сумма баллов в API. В JSON передаётся числом, тогда как decimal.Decimal по умолчанию пишется строкой.
+type Amount struct {
+	decimal.Decimal
+}
+
+func NewAmount(d decimal.Decimal) Amount {
+	return Amount{Decimal: d}
+}
+
+// MarshalJSON записывает сумму числом без кавычек.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
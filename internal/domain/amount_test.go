@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAmountJSON(t *testing.T) {
+	change := OrderStatusChange{To: Processed}
+	data, err := json.Marshal(BalanceOutput{Bonuses: NewAmount(decimal.RequireFromString("500.5")), Withdraw: NewAmount(decimal.NewFromInt(42))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"current":500.5,"withdrawn":42}`; got != want {
+		t.Errorf("balance JSON = %s, want %s", got, want)
+	}
+
+	data, err = json.Marshal(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"to":"PROCESSED","changed_at":""}`; got != want {
+		t.Errorf("status change JSON = %s, want %s", got, want)
+	}
+
+	// Сумма без обёртки по-прежнему пишется строкой: Amount не меняет глобальных настроек decimal.
+	data, err = json.Marshal(decimal.NewFromInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `"42"`; got != want {
+		t.Errorf("decimal JSON = %s, want %s", got, want)
+	}
+
+	for _, input := range []string{`{"sum":751.5}`, `{"sum":"751.5"}`} {
+		var withdraw Withdraw
+		if err := json.Unmarshal([]byte(input), &withdraw); err != nil {
+			t.Fatalf("unmarshal %s: %v", input, err)
+		}
+		if !withdraw.Bonuses.Equal(decimal.RequireFromString("751.5")) {
+			t.Errorf("unmarshal %s: sum = %s, want 751.5", input, withdraw.Bonuses)
+		}
+	}
+}
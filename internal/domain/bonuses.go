@@ -1,22 +1,42 @@
 package domain
 
-import (
-	"errors"
-)
+import "errors"
 
 var (
 	ErrNoWithdraws = errors.New("the user has no withdraws")
 	ErrNoBonuses   = errors.New("not enough bonuses")
+	// ErrIncorrectSum — сумма списания не положительна.
+	ErrIncorrectSum = errors.New("withdraw sum must be positive")
+	// ErrBalanceLocked — баланс слишком долго заблокирован параллельными изменениями.
+	ErrBalanceLocked    = errors.New("balance is locked by concurrent updates")
+	ErrWithdrawNotFound = errors.New("withdraw not found")
+	ErrWithdrawReversed = errors.New("withdraw is already reversed")
+)
+
+// WithdrawStatus — состояние списания.
+type WithdrawStatus string
+
+const (
+	WithdrawCompleted WithdrawStatus = "COMPLETED"
+	// WithdrawReversed — списание отменено, баллы возвращены пользователю.
+	WithdrawReversed WithdrawStatus = "REVERSED"
 )
 
 type Withdraw struct {
-	OrderID    string  `json:"order"`
-	Bonuses    float32 `json:"sum"`
-	UploadedAt string  `json:"processed_at"`
-	UserID     int64   `json:"-"`
+	OrderID    string         `json:"order"`
+	Bonuses    Amount         `json:"sum" swaggertype:"number"`
+	UploadedAt string         `json:"processed_at"`
+	Status     WithdrawStatus `json:"status,omitempty"`
+	ReversedAt string         `json:"reversed_at,omitempty"`
+	UserID     int64          `json:"-"`
+}
+
+// WithdrawReversal — запрос интеграции магазина на отмену списания по номеру заказа.
+type WithdrawReversal struct {
+	OrderID string `json:"order"`
 }
 
 type BalanceOutput struct {
-	Bonuses  float32 `json:"current"`
-	Withdraw float32 `json:"withdrawn"`
+	Bonuses  Amount `json:"current" swaggertype:"number"`
+	Withdraw Amount `json:"withdrawn" swaggertype:"number"`
 }
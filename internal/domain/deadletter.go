@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrInvalidPayload — ответ системы расчёта по заказу не удаётся сохранить из-за его содержимого,
+	// и повторная запись того же ответа закончится так же.
+	ErrInvalidPayload = errors.New("accrual response cannot be stored")
+)
+
+// OrderFailure — сбой обработки ответа системы расчёта по заказу.
+type OrderFailure struct {
+	OrderID string
+	Error   string
+	// Payload — исходный ответ системы расчёта, если он был получен.
+	Payload     []byte
+	NextCheckAt time.Time
+}
+
+// DeadLetter — заказ, исключённый из опроса после повторяющихся сбоев обработки.
+type DeadLetter struct {
+	OrderID   string      `json:"order"`
+	Status    OrderStatus `json:"status"`
+	Failures  int         `json:"failures"`
+	LastError string      `json:"last_error"`
+	Payload   string      `json:"payload,omitempty"`
+	CreatedAt string      `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package domain
+
+// LedgerKind — вид записи в журнале баллов.
+type LedgerKind string
+
+// Каждое изменение баланса пользователя — ровно одна запись журнала со знаковой суммой
+// и ссылкой на источник: номер начисленного заказа или заказа, в счёт которого списаны баллы.
+// Отмена списания ссылается на номер заказа отменённого списания.
+const (
+	// LedgerAccrual — начисление за обработанный заказ, положительная сумма.
+	LedgerAccrual LedgerKind = "accrual"
+	// LedgerWithdrawal — списание в счёт заказа, отрицательная сумма.
+	LedgerWithdrawal LedgerKind = "withdrawal"
+	// LedgerAdjustment — исправление ранее начисленной суммы, например по итогам сверки.
+	LedgerAdjustment LedgerKind = "adjustment"
+	// LedgerReversal — возврат баллов по отменённому списанию, положительная сумма.
+	LedgerReversal LedgerKind = "reversal"
+)
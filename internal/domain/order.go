@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 )
 
 type OrderStatus string
@@ -11,6 +13,12 @@ var (
 	ErrAlreadyUploadedByAnotherUser = errors.New("the order number has already been uploaded by another user")
 	ErrIncorrectOrder               = errors.New("incorrect order id")
 	ErrNoData                       = errors.New("no response data")
+	ErrOrderLeaseLost               = errors.New("order lease expired or taken by another instance")
+	ErrOrderNotFound                = errors.New("order not found")
+	ErrOrderFinished                = errors.New("order is already finished")
+	ErrOrderUnchanged               = errors.New("order already has this status and accrual")
+	ErrStatusTransition             = errors.New("forbidden order status transition")
+	ErrUnknownStatus                = errors.New("unknown order status")
 )
 
 const (
@@ -19,12 +27,84 @@ const (
 	Registered OrderStatus = "REGISTERED"
 	Invalid OrderStatus = "INVALID"
 	Processed OrderStatus = "PROCESSED"
+	// Unregistered — система расчёта так и не узнала о заказе, опрос прекращён.
+	Unregistered OrderStatus = "UNREGISTERED"
 )
 
+// orderTransitions — допустимые переходы статусов заказа: NEW → PROCESSING → PROCESSED/INVALID.
+// PROCESSED и INVALID окончательные, переходов из них нет. Новый заказ, не зарегистрированный
+// в системе расчёта, переходит в UNREGISTERED, откуда администратор может вернуть его в NEW.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	NewOrder:     {Processing, Processed, Invalid, Unregistered},
+	Processing:   {Processing, Processed, Invalid},
+	Unregistered: {NewOrder},
+}
+
+// CanTransitionTo сообщает, можно ли перевести заказ из статуса s в next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal сообщает, является ли статус окончательным для опроса системы расчёта.
+func (s OrderStatus) IsTerminal() bool {
+	return s == Processed || s == Invalid || s == Unregistered
+}
+
+// TransitionSources возвращает статусы, из которых допустим переход в next.
+func TransitionSources(next OrderStatus) []OrderStatus {
+	var sources []OrderStatus
+	for from, targets := range orderTransitions {
+		for _, status := range targets {
+			if status == next {
+				sources = append(sources, from)
+			}
+		}
+	}
+	return sources
+}
+
+// Transitions возвращает все допустимые переходы статусов парами from[i] → to[i].
+func Transitions() (from, to []OrderStatus) {
+	for source, targets := range orderTransitions {
+		for _, target := range targets {
+			from = append(from, source)
+			to = append(to, target)
+		}
+	}
+	return from, to
+}
+
+// ParseAccrualStatus приводит статус системы расчёта к статусу заказа.
+// REGISTERED означает, что заказ принят системой расчёта, но начисление ещё не рассчитано, и соответствует PROCESSING.
+func ParseAccrualStatus(status OrderStatus) (OrderStatus, error) {
+	switch status {
+	case Registered, Processing:
+		return Processing, nil
+	case Processed, Invalid:
+		return status, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownStatus, status)
+	}
+}
+
 type Order struct {
-	OrderID    string      `json:"number"`
-	Status     OrderStatus `json:"status"`
-	Bonuses    float32     `json:"accrual"`
-	UploadedAt string      `json:"uploaded_at"`
-	UserID     int64       `json:"-"`
+	OrderID    string          `json:"number"`
+	Status     OrderStatus     `json:"status"`
+	Bonuses    Amount          `json:"accrual" swaggertype:"number"`
+	UploadedAt string          `json:"uploaded_at"`
+	UserID     int64           `json:"-"`
+}
+
+// OrderStatusChange — запись истории статусов заказа.
+type OrderStatusChange struct {
+	From      OrderStatus      `json:"from,omitempty"`
+	To        OrderStatus      `json:"to"`
+	Bonuses   *Amount          `json:"accrual,omitempty" swaggertype:"number"`
+	Payload   json.RawMessage  `json:"payload,omitempty" swaggertype:"object"`
+	ChangedAt string           `json:"changed_at"`
 }
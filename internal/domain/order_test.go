@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	statuses := []OrderStatus{NewOrder, Processing, Processed, Invalid, Unregistered}
+	allowed := map[OrderStatus][]OrderStatus{
+		NewOrder:     {Processing, Processed, Invalid, Unregistered},
+		Processing:   {Processing, Processed, Invalid},
+		Processed:    nil,
+		Invalid:      nil,
+		Unregistered: {NewOrder},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := slices.Contains(allowed[from], to)
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	tests := []struct {
+		next OrderStatus
+		want []OrderStatus
+	}{
+		{NewOrder, []OrderStatus{Unregistered}},
+		{Processing, []OrderStatus{NewOrder, Processing}},
+		{Processed, []OrderStatus{NewOrder, Processing}},
+		{Invalid, []OrderStatus{NewOrder, Processing}},
+		{Unregistered, []OrderStatus{NewOrder}},
+		{Registered, nil},
+	}
+	for _, tt := range tests {
+		got := TransitionSources(tt.next)
+		slices.Sort(got)
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("TransitionSources(%s) = %v, want %v", tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	from, to := Transitions()
+	if len(from) != len(to) || len(from) != 8 {
+		t.Fatalf("Transitions returned %d sources and %d targets, want 8 pairs", len(from), len(to))
+	}
+	for i := range from {
+		if !from[i].CanTransitionTo(to[i]) {
+			t.Errorf("Transitions pair %s -> %s is not allowed", from[i], to[i])
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	for status, want := range map[OrderStatus]bool{
+		NewOrder:     false,
+		Processing:   false,
+		Registered:   false,
+		Processed:    true,
+		Invalid:      true,
+		Unregistered: true,
+	} {
+		if got := status.IsTerminal(); got != want {
+			t.Errorf("%s terminal = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestParseAccrualStatus(t *testing.T) {
+	tests := []struct {
+		status OrderStatus
+		want   OrderStatus
+	}{
+		{Registered, Processing},
+		{Processing, Processing},
+		{Processed, Processed},
+		{Invalid, Invalid},
+	}
+	for _, tt := range tests {
+		got, err := ParseAccrualStatus(tt.status)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAccrualStatus(%s) = %s, %v, want %s", tt.status, got, err, tt.want)
+		}
+	}
+
+	for _, status := range []OrderStatus{NewOrder, Unregistered, "UNKNOWN", ""} {
+		if _, err := ParseAccrualStatus(status); !errors.Is(err, ErrUnknownStatus) {
+			t.Errorf("ParseAccrualStatus(%q) error = %v, want %v", status, err, ErrUnknownStatus)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrNegativeCorrection — исправление заказа списало бы больше баллов, чем осталось на балансе пользователя.
+var ErrNegativeCorrection = errors.New("correction would make balance negative")
+
+// Discrepancy — расхождение сохранённого расчёта заказа с ответом системы расчёта.
+type Discrepancy struct {
+	OrderID       string      `json:"order"`
+	Provider      string      `json:"provider"`
+	StoredStatus  OrderStatus `json:"stored_status"`
+	StoredBonuses Amount      `json:"stored_accrual" swaggertype:"number"`
+	// RemoteStatus пустой, если система расчёта не знает о заказе.
+	RemoteStatus  OrderStatus     `json:"remote_status,omitempty"`
+	RemoteBonuses Amount          `json:"remote_accrual" swaggertype:"number"`
+	Payload       json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+	Corrected     bool            `json:"corrected"`
+}
+
+// Correctable сообщает, можно ли исправить заказ по ответу системы расчёта:
+// исправляются только окончательные расчёты, чтобы заказ не вернулся в очередь опроса.
+func (d Discrepancy) Correctable() bool {
+	return d.RemoteStatus == Processed || d.RemoteStatus == Invalid
+}
+
+// ReconcileReport — итог сверки расчётов с системами расчёта.
+type ReconcileReport struct {
+	Checked       int `json:"checked"`
+	Discrepancies int `json:"discrepancies"`
+	Corrected     int `json:"corrected"`
+	// Skipped — заказы, которые не удалось сверить: провайдер не найден, не опрашивается или ответил ошибкой.
+	Skipped int `json:"skipped"`
+}
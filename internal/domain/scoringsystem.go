@@ -1,7 +1,48 @@
 package domain
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 type ScoringSystem struct {
-	OrderID string      `json:"order"`
-	Status  OrderStatus `json:"status"`
-	Bonuses float32     `json:"accrual"`
+	OrderID string          `json:"order"`
+	Status  OrderStatus     `json:"status"`
+	Bonuses decimal.Decimal `json:"accrual" swaggertype:"number"`
+	// Payload — исходный ответ системы расчёта, сохраняется в истории статусов.
+	Payload json.RawMessage `json:"-"`
+	// Provider — имя системы расчёта, приславшей ответ.
+	Provider string `json:"-"`
+}
+
+// OrderUpdate — ответ системы расчёта по заказу и время его следующей проверки.
+type OrderUpdate struct {
+	Order       ScoringSystem
+	NextCheckAt time.Time
+}
+
+// PendingOrder — заказ, захваченный для проверки в системе расчёта.
+type PendingOrder struct {
+	OrderID    string
+	Status     OrderStatus
+	Attempts   int
+	UploadedAt time.Time
+}
+
+// RecheckResult — итог внеочередной проверки заказа администратором.
+type RecheckResult struct {
+	Provider string `json:"provider,omitempty"`
+	// Response — исходный ответ системы расчёта, пустой, если она не знает о заказе.
+	Response json.RawMessage `json:"response,omitempty" swaggertype:"object"`
+	// Error — почему ответ не применён к заказу, например запрещённый переход статуса.
+	Error string `json:"error,omitempty"`
+	Order Order  `json:"order"`
+}
+
+// CallbackResult — итог применения статусов, присланных системой расчёта.
+type CallbackResult struct {
+	Applied int      `json:"applied"`
+	Failed  []string `json:"failed,omitempty"`
 }
@@ -0,0 +1,117 @@
+// Package httpclient — общий HTTP-клиент для исходящих запросов к внешним системам
+// с ограниченным пулом соединений и таймаутом на каждый запрос.
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// drainLimit — сколько непрочитанного тела ответа дочитывается перед закрытием,
+// чтобы соединение можно было вернуть в пул. Более длинные ответы проще закрыть вместе с соединением.
+const drainLimit = 64 << 10
+
+type Config struct {
+	// RequestTimeout ограничивает весь запрос, включая чтение тела ответа.
+	RequestTimeout time.Duration
+	DialTimeout    time.Duration
+	// KeepAlive — период TCP keep-alive проб, отрицательный отключает пробы.
+	// На повторное использование соединений пула он не влияет.
+	KeepAlive           time.Duration
+	IdleConnTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	// MaxBodySize — максимальный размер тела ответа.
+	MaxBodySize int64
+}
+
+// Response — ответ с уже прочитанным телом, соединение к этому моменту возвращено в пул.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type Client struct {
+	client         *http.Client
+	requestTimeout time.Duration
+	maxBodySize    int64
+}
+
+func New(cfg Config) *Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &Client{
+		client:         &http.Client{Transport: transport},
+		requestTimeout: cfg.RequestTimeout,
+		maxBodySize:    cfg.MaxBodySize,
+	}
+}
+
+// Get выполняет GET-запрос с таймаутом RequestTimeout поверх ctx, читает тело ответа
+// не больше MaxBodySize и всегда закрывает его.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("httpclient: get %s", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpclient: get %s", err)
+	}
+	defer Drain(resp.Body)
+
+	body := io.Reader(resp.Body)
+	if c.maxBodySize > 0 {
+		body = io.LimitReader(resp.Body, c.maxBodySize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("httpclient: get %s", err)
+	}
+	if c.maxBodySize > 0 && int64(len(data)) > c.maxBodySize {
+		return nil, fmt.Errorf("httpclient: get response body exceeds %d bytes", c.maxBodySize)
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       data,
+	}, nil
+}
+
+// CloseIdleConnections закрывает простаивающие соединения пула.
+func (c *Client) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
+
+// Drain дочитывает и закрывает тело ответа, чтобы соединение вернулось в пул.
+func Drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, drainLimit))
+	body.Close()
+}
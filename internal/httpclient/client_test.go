@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestClientReusesConnections проверяет, что отключение TCP keep-alive проб не отключает пул соединений.
+func TestClientReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := New(Config{RequestTimeout: time.Second, KeepAlive: -1, MaxIdleConnsPerHost: 1})
+	defer client.CloseIdleConnections()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Body) != "ok" {
+			t.Fatalf("body = %q, want ok", resp.Body)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("opened %d connections for 3 sequential requests, want 1", n)
+	}
+}
+
+func TestClientMaxBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 11)))
+	}))
+	defer server.Close()
+
+	client := New(Config{RequestTimeout: time.Second, MaxBodySize: 10})
+	defer client.CloseIdleConnections()
+
+	if _, err := client.Get(context.Background(), server.URL); err == nil {
+		t.Error("Get with a body over MaxBodySize succeeded")
+	}
+}
@@ -0,0 +1,196 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config — параметры выбора лидера.
+type Config struct {
+	// Renew — как часто лидер проверяет, что блокировка всё ещё за ним,
+	// а остальные экземпляры пытаются её захватить.
+	Renew time.Duration
+}
+
+// Elector выбирает среди экземпляров сервиса одного исполнителя для задач-одиночек.
+// Лидерство по задаче — это advisory-lock Postgres на отдельном соединении с ключом из имени задачи.
+// Если экземпляр-лидер падает, Postgres закрывает его сессию и снимает блокировку,
+// и её захватывает следующий экземпляр.
+type Elector struct {
+	db     *sql.DB
+	renew  time.Duration
+	logger *log.Logger
+
+	mu      sync.Mutex
+	leading map[string]bool
+}
+
+func NewElector(db *sql.DB, cfg Config, logger *log.Logger) *Elector {
+	renew := cfg.Renew
+	if renew <= 0 {
+		renew = 5 * time.Second
+	}
+	return &Elector{
+		db:      db,
+		renew:   renew,
+		logger:  logger,
+		leading: make(map[string]bool),
+	}
+}
+
+// Run выполняет job, пока этот экземпляр лидирует по задаче name. Контекст job отменяется
+// при потере лидерства, после чего Run снова ждёт своей очереди. Блокирует до отмены ctx.
+func (e *Elector) Run(ctx context.Context, name string, job func(ctx context.Context)) {
+	e.setLeading(name, false)
+
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+
+	for {
+		conn, err := e.acquire(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			e.logError(name, err)
+		}
+		if conn != nil {
+			e.lead(ctx, conn, name, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status возвращает задачи, о которых знает экземпляр, и признак его лидерства по каждой.
+func (e *Elector) Status() map[string]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := make(map[string]bool, len(e.leading))
+	for name, leading := range e.leading {
+		status[name] = leading
+	}
+	return status
+}
+
+// acquire пытается захватить блокировку задачи. Возвращает соединение, на котором она удерживается,
+// или nil, если блокировка занята другим экземпляром.
+func (e *Elector) acquire(ctx context.Context, name string) (*sql.Conn, error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("leader: acquire %s", err)
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", name).Scan(&locked)
+	if err != nil {
+		// Блокировка могла быть взята до обрыва запроса, поэтому сессию нельзя возвращать в пул.
+		discard(conn)
+		return nil, fmt.Errorf("leader: acquire %s", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// lead выполняет job и продлевает лидерство, пока блокировка удерживается и ctx не отменён.
+func (e *Elector) lead(ctx context.Context, conn *sql.Conn, name string, job func(ctx context.Context)) {
+	e.setLeading(name, true)
+	e.logger.WithFields(log.Fields{"job": name}).Info("acquired leadership")
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		job(jobCtx)
+	}()
+
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-done:
+			break loop
+		case <-ticker.C:
+			if err := e.check(ctx, conn, name); err != nil {
+				if ctx.Err() == nil {
+					e.logError(name, err)
+				}
+				break loop
+			}
+		}
+	}
+
+	cancel()
+	<-done
+	e.setLeading(name, false)
+	e.release(conn, name)
+	e.logger.WithFields(log.Fields{"job": name}).Info("released leadership")
+}
+
+// check убеждается, что сессия жива и блокировка задачи всё ещё принадлежит ей.
+func (e *Elector) check(ctx context.Context, conn *sql.Conn, name string) error {
+	var held bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted AND objsubid = 1
+				AND (classid::bigint << 32 | objid::bigint) = hashtextextended($1, 0)
+		)`, name).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("leader: renew %s", err)
+	}
+	if !held {
+		return fmt.Errorf("leader: renew lock %s is lost", name)
+	}
+	return nil
+}
+
+// release снимает блокировку и возвращает соединение в пул. Если снять блокировку не удалось,
+// соединение закрывается вместе с сессией: иначе блокировка осталась бы на соединении в пуле,
+// и ни один экземпляр не смог бы её захватить, пока жива сессия.
+func (e *Elector) release(conn *sql.Conn, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.renew)
+	defer cancel()
+
+	var unlocked bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock(hashtextextended($1, 0))", name).Scan(&unlocked)
+	if err != nil || !unlocked {
+		if err != nil {
+			e.logError(name, fmt.Errorf("leader: release %s", err))
+		}
+		discard(conn)
+		return
+	}
+	conn.Close()
+}
+
+// discard закрывает соединение, не возвращая его в пул, и тем самым завершает сессию Postgres
+// со всеми её advisory-lock.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+func (e *Elector) setLeading(name string, leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading[name] = leading
+}
+
+func (e *Elector) logError(name string, err error) {
+	e.logger.WithFields(log.Fields{"job": name}).Error(err)
+}
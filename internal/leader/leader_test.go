@@ -0,0 +1,116 @@
+package leader
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	log "github.com/sirupsen/logrus"
+)
+
+func newTestElector(t *testing.T) *Elector {
+	t.Helper()
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return NewElector(repositorytest.New(t).DB, Config{Renew: 50 * time.Millisecond}, logger)
+}
+
+// waitLeading ждёт, пока elector не станет или не перестанет быть лидером по задаче name.
+func waitLeading(t *testing.T, e *Elector, name string, leading bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Status()[name] != leading {
+		if time.Now().After(deadline) {
+			t.Fatalf("leading %s = %t, want %t", name, !leading, leading)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestElectorLoseAndReacquire проверяет, что лидерство переходит к другому экземпляру, когда сессия
+// лидера разорвана, и возвращается обратно, когда новый лидер останавливается.
+func TestElectorLoseAndReacquire(t *testing.T) {
+	first := newTestElector(t)
+	second := NewElector(first.db, Config{Renew: first.renew}, first.logger)
+	name := t.Name()
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	defer stopFirst()
+	go first.Run(firstCtx, name, func(ctx context.Context) { <-ctx.Done() })
+	waitLeading(t, first, name, true)
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+		second.Run(secondCtx, name, func(ctx context.Context) { <-ctx.Done() })
+	}()
+
+	_, err := first.db.Exec(`SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND objsubid = 1 AND (classid::bigint << 32 | objid::bigint) = hashtextextended($1, 0)`, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitLeading(t, first, name, false)
+	waitLeading(t, second, name, true)
+
+	stopSecond()
+	<-secondDone
+	waitLeading(t, first, name, true)
+}
+
+// TestDiscardEndsSession проверяет, что discard не возвращает сессию с блокировкой в пул.
+func TestDiscardEndsSession(t *testing.T) {
+	e := newTestElector(t)
+	e.db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	conn, err := e.acquire(ctx, t.Name())
+	if err != nil || conn == nil {
+		t.Fatalf("acquire = %v, %v", conn, err)
+	}
+	var pid int
+	if err := conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+		t.Fatal(err)
+	}
+	discard(conn)
+
+	next, err := e.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+
+	var nextPid int
+	if err := next.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&nextPid); err != nil {
+		t.Fatal(err)
+	}
+	if nextPid == pid {
+		t.Errorf("discarded session %d was returned to the pool", pid)
+	}
+
+	// Сервер завершает сессию асинхронно, поэтому блокировка снимается не сразу.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var held bool
+		err = next.QueryRowContext(ctx, `SELECT EXISTS (
+				SELECT 1 FROM pg_locks
+				WHERE locktype = 'advisory' AND objsubid = 1 AND (classid::bigint << 32 | objid::bigint) = hashtextextended($1, 0)
+			)`, t.Name()).Scan(&held)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !held {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lock is still held after discard")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
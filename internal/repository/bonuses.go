@@ -3,14 +3,30 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
 )
 
+const (
+	// lockNotAvailable — код ошибки Postgres при истечении lock_timeout.
+	lockNotAvailable = "55P03"
+	// balanceLockTimeout ограничивает ожидание блокировки строки баланса, которую держат параллельные изменения баланса.
+	balanceLockTimeout = "3s"
+)
+
+// Withdraw записывает списание и соответствующую ему запись журнала баллов.
 func (s *Storage) Withdraw(ctx context.Context, withdraw domain.Withdraw) error {
-	result, err := s.DB.ExecContext(ctx, "INSERT INTO withdrawals (order_id, bonuses, uploaded_at, user_id) values ($1, $2, $3, $4) on conflict (order_id) do nothing",
-		withdraw.OrderID, withdraw.Bonuses, withdraw.UploadedAt, withdraw.UserID)
+	result, err := s.conn(ctx).ExecContext(ctx, `WITH inserted AS (
+			INSERT INTO withdrawals (order_id, bonuses, uploaded_at, user_id) values ($1, $2, $3, $4) on conflict (order_id) do nothing
+			RETURNING order_id, bonuses, uploaded_at, user_id
+		)
+		INSERT INTO ledger_entries (user_id, kind, amount, reference, created_at)
+		SELECT user_id, $5, -bonuses, order_id, uploaded_at FROM inserted`,
+		withdraw.OrderID, withdraw.Bonuses, withdraw.UploadedAt, withdraw.UserID, domain.LedgerWithdrawal)
 	if err != nil {
 		return fmt.Errorf("postgreSQL: withdraw %s", err)
 	}
@@ -36,20 +52,55 @@ func (s *Storage) Withdraw(ctx context.Context, withdraw domain.Withdraw) error
 	return nil
 }
 
+// DebitBalance списывает amount с баланса пользователя, если баллов хватает, иначе возвращает domain.ErrNoBonuses.
+// Проверка и списание выполняются одним UPDATE под блокировкой строки баланса, поэтому параллельные
+// списания ждут друг друга и видят уже уменьшенный баланс. Вызывается внутри WithinTx: блокировка держится
+// до конца транзакции. Если строку не удалось заблокировать за balanceLockTimeout, возвращается domain.ErrBalanceLocked.
+func (s *Storage) DebitBalance(ctx context.Context, userID int64, amount decimal.Decimal) error {
+	if _, err := s.conn(ctx).ExecContext(ctx, "SET LOCAL lock_timeout = '"+balanceLockTimeout+"'"); err != nil {
+		return fmt.Errorf("postgreSQL: debitBalance %s", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, `UPDATE balances SET current = current - $2, withdrawn = withdrawn + $2,
+		version = version + 1, updated_at = now()
+		WHERE user_id=$1 AND current >= $2`,
+		userID, amount)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable {
+		return domain.ErrBalanceLocked
+	}
+	if err != nil {
+		return fmt.Errorf("postgreSQL: debitBalance %s", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgreSQL: debitBalance %s", err)
+	}
+	if rowsAffected == 0 {
+		return domain.ErrNoBonuses
+	}
+	return nil
+}
+
 func (s *Storage) Withdrawals(ctx context.Context, userID int64) ([]domain.Withdraw, error) {
 	var withdrawals []domain.Withdraw
-	rows, err := s.DB.QueryContext(ctx, "SELECT order_id, bonuses, uploaded_at FROM withdrawals WHERE user_id = $1 ORDER BY uploaded_at DESC", userID)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT order_id, bonuses, uploaded_at, status, reversed_at FROM withdrawals WHERE user_id = $1 ORDER BY uploaded_at DESC", userID)
 	if err != nil {
 		return nil, fmt.Errorf("postgreSQL: withdrawals %s", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var withdraw domain.Withdraw
-		err := rows.Scan(&withdraw.OrderID, &withdraw.Bonuses, &withdraw.UploadedAt)
+		var (
+			withdraw   domain.Withdraw
+			reversedAt sql.NullString
+		)
+		err := rows.Scan(&withdraw.OrderID, &withdraw.Bonuses, &withdraw.UploadedAt, &withdraw.Status, &reversedAt)
 		if err != nil {
 			return nil, fmt.Errorf("postgreSQL: withdrawals %s", err)
 		}
+		withdraw.ReversedAt = reversedAt.String
 		withdrawals = append(withdrawals, withdraw)
 	}
 
@@ -65,39 +116,137 @@ func (s *Storage) Withdrawals(ctx context.Context, userID int64) ([]domain.Withd
 	return withdrawals, nil
 }
 
-func (s *Storage) Balance(ctx context.Context, userID int64) (float32, error) {
-	var nullableBalance sql.NullFloat64
-	err := s.DB.QueryRowContext(ctx, "SELECT SUM(bonuses) FROM orders WHERE user_id=$1", userID).
-		Scan(&nullableBalance)
-	if err != nil {
-		return 0, fmt.Errorf("postgreSQL: balance %s", err)
+// Balance возвращает текущий баланс пользователя и сумму списаний.
+func (s *Storage) Balance(ctx context.Context, userID int64) (domain.BalanceOutput, error) {
+	var balance domain.BalanceOutput
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT current, withdrawn FROM balances WHERE user_id=$1", userID).
+		Scan(&balance.Bonuses, &balance.Withdraw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.BalanceOutput{}, nil
 	}
-	if !nullableBalance.Valid {
-		return 0, nil
+	if err != nil {
+		return domain.BalanceOutput{}, fmt.Errorf("postgreSQL: balance %s", err)
 	}
-
-	balance := float32(nullableBalance.Float64)
 	return balance, nil
 }
 
-func (s *Storage) WithdrawBalance(ctx context.Context, userID int64) (float32, error) {
-	var nullableBalance sql.NullFloat64
-	err := s.DB.QueryRowContext(ctx, "SELECT SUM(bonuses) FROM withdrawals WHERE user_id=$1", userID).
-		Scan(&nullableBalance)
+// RepairBalances пересчитывает балансы всех пользователей по журналу баллов и возвращает
+// число исправленных балансов. Баланс каждого пользователя пересчитывается в отдельной транзакции
+// под блокировкой его строки, поэтому начисление или списание, зафиксированное во время ремонта,
+// не затирается устаревшей суммой.
+func (s *Storage) RepairBalances(ctx context.Context) (int64, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id FROM users ORDER BY id")
 	if err != nil {
-		return 0, fmt.Errorf("postgreSQL: withdrawBalance %s", err)
+		return 0, fmt.Errorf("postgreSQL: repairBalances %s", err)
 	}
-	if !nullableBalance.Valid {
-		return 0, nil
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return 0, fmt.Errorf("postgreSQL: repairBalances %s", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("postgreSQL: repairBalances %s", err)
 	}
 
-	balance := float32(nullableBalance.Float64)
-	return balance, nil
+	var repaired int64
+	for _, userID := range userIDs {
+		fixed, err := s.repairBalance(ctx, userID)
+		if err != nil {
+			return repaired, err
+		}
+		if fixed {
+			repaired++
+		}
+	}
+	return repaired, nil
+}
+
+// repairBalance пересчитывает баланс пользователя по журналу. Сумма по журналу читается
+// после блокировки строки баланса и потому учитывает все зафиксированные изменения баланса.
+func (s *Storage) repairBalance(ctx context.Context, userID int64) (bool, error) {
+	var fixed bool
+	err := s.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := s.conn(ctx).ExecContext(ctx, "SELECT 1 FROM balances WHERE user_id=$1 FOR UPDATE", userID)
+		if err != nil {
+			return fmt.Errorf("postgreSQL: repairBalances %s", err)
+		}
+
+		result, err := s.conn(ctx).ExecContext(ctx, `INSERT INTO balances (user_id, current, withdrawn)
+			SELECT $1, COALESCE(SUM(amount), 0), COALESCE(-SUM(amount) FILTER (WHERE kind IN ($2, $3)), 0)
+			FROM ledger_entries WHERE user_id = $1
+			ON CONFLICT (user_id) DO UPDATE SET current = EXCLUDED.current, withdrawn = EXCLUDED.withdrawn,
+				version = balances.version + 1, updated_at = now()
+			WHERE balances.current <> EXCLUDED.current OR balances.withdrawn <> EXCLUDED.withdrawn`,
+			userID, domain.LedgerWithdrawal, domain.LedgerReversal)
+		if err != nil {
+			return fmt.Errorf("postgreSQL: repairBalances %s", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("postgreSQL: repairBalances %s", err)
+		}
+		fixed = rowsAffected > 0
+		return nil
+	})
+	return fixed, err
+}
+
+// ReverseWithdraw отменяет списание: помечает его отменённым, записывает в журнал возврат баллов
+// со ссылкой на списание и возвращает баллы на баланс пользователя одним запросом.
+// Возвращает отменённое списание.
+func (s *Storage) ReverseWithdraw(ctx context.Context, orderID string) (domain.Withdraw, error) {
+	var (
+		withdraw   domain.Withdraw
+		reversedAt sql.NullString
+	)
+	err := s.conn(ctx).QueryRowContext(ctx, `WITH reversed AS (
+			UPDATE withdrawals SET status = $2, reversed_at = now()
+			WHERE order_id = $1 AND status = $3
+			RETURNING order_id, bonuses, uploaded_at, status, reversed_at, user_id
+		), entry AS (
+			INSERT INTO ledger_entries (user_id, kind, amount, reference)
+			SELECT user_id, $4, bonuses, order_id FROM reversed
+			RETURNING user_id, amount
+		), balance AS (
+			UPDATE balances b SET current = b.current + entry.amount, withdrawn = b.withdrawn - entry.amount,
+				version = b.version + 1, updated_at = now()
+			FROM entry WHERE b.user_id = entry.user_id
+		)
+		SELECT order_id, bonuses, uploaded_at, status, reversed_at, user_id FROM reversed`,
+		orderID, domain.WithdrawReversed, domain.WithdrawCompleted, domain.LedgerReversal).
+		Scan(&withdraw.OrderID, &withdraw.Bonuses, &withdraw.UploadedAt, &withdraw.Status, &reversedAt, &withdraw.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Withdraw{}, s.reverseWithdrawError(ctx, orderID)
+	}
+	if err != nil {
+		return domain.Withdraw{}, fmt.Errorf("postgreSQL: reverseWithdraw %s", err)
+	}
+	withdraw.ReversedAt = reversedAt.String
+	return withdraw, nil
+}
+
+// reverseWithdrawError объясняет, почему списание не удалось отменить.
+func (s *Storage) reverseWithdrawError(ctx context.Context, orderID string) error {
+	var status domain.WithdrawStatus
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT status FROM withdrawals WHERE order_id=$1", orderID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrWithdrawNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("postgreSQL: reverseWithdraw %s", err)
+	}
+	return domain.ErrWithdrawReversed
 }
 
 func (s *Storage) checkWithdraw(ctx context.Context, withdraw domain.Withdraw) (int64, error) {
 	var userID int64
-	err := s.DB.QueryRowContext(ctx, "SELECT user_id FROM withdrawals WHERE order_id=$1", withdraw.OrderID).
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT user_id FROM withdrawals WHERE order_id=$1", withdraw.OrderID).
 		Scan(&userID)
 	if err != nil {
 		return 0, fmt.Errorf("postgreSQL: checkWithdraw %s", err)
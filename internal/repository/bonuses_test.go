@@ -0,0 +1,150 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	"github.com/shopspring/decimal"
+)
+
+func TestDebitBalance(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "debit")
+	repositorytest.Credit(t, storage, userID, "500")
+
+	err := storage.WithinTx(ctx, func(ctx context.Context) error {
+		return storage.DebitBalance(ctx, userID, decimal.NewFromInt(501))
+	})
+	if !errors.Is(err, domain.ErrNoBonuses) {
+		t.Fatalf("DebitBalance over balance error = %v, want %v", err, domain.ErrNoBonuses)
+	}
+
+	err = storage.WithinTx(ctx, func(ctx context.Context) error {
+		return storage.DebitBalance(ctx, userID, decimal.NewFromInt(100))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.Equal(decimal.NewFromInt(400)) || !balance.Withdraw.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("balance after debit = %+v", balance)
+	}
+}
+
+// TestDebitBalanceLocked проверяет, что списание не ждёт заблокированный баланс дольше lock_timeout.
+func TestDebitBalanceLocked(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "locked")
+	repositorytest.Credit(t, storage, userID, "500")
+
+	holder, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Rollback()
+	if _, err := holder.ExecContext(ctx, "SELECT 1 FROM balances WHERE user_id=$1 FOR UPDATE", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	err = storage.WithinTx(ctx, func(ctx context.Context) error {
+		return storage.DebitBalance(ctx, userID, decimal.NewFromInt(100))
+	})
+	if !errors.Is(err, domain.ErrBalanceLocked) {
+		t.Fatalf("DebitBalance on locked balance error = %v, want %v", err, domain.ErrBalanceLocked)
+	}
+	if waited := time.Since(started); waited > 10*time.Second {
+		t.Errorf("DebitBalance waited %s for the lock", waited)
+	}
+}
+
+func TestRepairBalances(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "repair")
+	repositorytest.Credit(t, storage, userID, "250.25")
+
+	_, err := storage.DB.ExecContext(ctx, "UPDATE balances SET current=999, withdrawn=1 WHERE user_id=$1", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repaired, err := storage.RepairBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != 1 {
+		t.Errorf("repaired = %d, want 1", repaired)
+	}
+
+	balance, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.Equal(decimal.RequireFromString("250.25")) || !balance.Withdraw.IsZero() {
+		t.Errorf("repaired balance = %+v", balance)
+	}
+
+	if repaired, err := storage.RepairBalances(ctx); err != nil || repaired != 0 {
+		t.Errorf("second repair = %d, %v, want 0, nil", repaired, err)
+	}
+}
+
+// TestReverseWithdraw проверяет, что отмена списания возвращает баллы записью журнала и выполняется один раз.
+func TestReverseWithdraw(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "reverse")
+	repositorytest.Credit(t, storage, userID, "500")
+
+	withdraw(t, storage, userID, "2377225624", 200)
+
+	reversed, err := storage.ReverseWithdraw(ctx, "2377225624")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversed.Status != domain.WithdrawReversed || reversed.ReversedAt == "" || reversed.UserID != userID {
+		t.Errorf("reversed withdraw = %+v", reversed)
+	}
+
+	balance, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.Equal(decimal.NewFromInt(500)) || !balance.Withdraw.IsZero() {
+		t.Errorf("balance after reversal = %+v, want 500 current and 0 withdrawn", balance)
+	}
+
+	var amount decimal.Decimal
+	err = storage.DB.QueryRowContext(ctx, "SELECT amount FROM ledger_entries WHERE kind=$1 AND reference=$2",
+		domain.LedgerReversal, "2377225624").Scan(&amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !amount.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("reversal ledger amount = %s, want 200", amount)
+	}
+
+	if _, err := storage.ReverseWithdraw(ctx, "2377225624"); !errors.Is(err, domain.ErrWithdrawReversed) {
+		t.Errorf("second reversal error = %v, want %v", err, domain.ErrWithdrawReversed)
+	}
+	if _, err := storage.ReverseWithdraw(ctx, "12345678903"); !errors.Is(err, domain.ErrWithdrawNotFound) {
+		t.Errorf("unknown order reversal error = %v, want %v", err, domain.ErrWithdrawNotFound)
+	}
+	balance, err = storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.Equal(decimal.NewFromInt(500)) {
+		t.Errorf("balance after second reversal = %s, want 500", balance.Bonuses)
+	}
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+)
+
+// FailOrder засчитывает заказу сбой обработки, снимает аренду owner и откладывает следующую проверку.
+// Когда сбоев набирается maxFailures, заказ переносится в accrual_dead_letters с последней ошибкой
+// и исходным ответом и больше не опрашивается; тогда возвращает true. 0 — без ограничения.
+func (s *Storage) FailOrder(ctx context.Context, owner string, failure domain.OrderFailure, maxFailures int) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("postgreSQL: failOrder %s", err)
+	}
+	defer tx.Rollback()
+
+	var failures int
+	err = tx.QueryRowContext(ctx, `UPDATE orders SET failures=failures+1, attempts=attempts+1, priority=0, next_check_at=$1,
+			locked_by=NULL, locked_until=NULL
+		WHERE order_id=$2 AND ($3 = '' OR locked_by=$3)
+		RETURNING failures`, failure.NextCheckAt, failure.OrderID, owner).
+		Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, domain.ErrOrderLeaseLost
+	}
+	if err != nil {
+		return false, fmt.Errorf("postgreSQL: failOrder %s", err)
+	}
+
+	deadLettered := maxFailures > 0 && failures >= maxFailures
+	if deadLettered {
+		var payload *string
+		if failure.Payload != nil {
+			raw := string(failure.Payload)
+			payload = &raw
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO accrual_dead_letters (order_id, failures, last_error, payload) values ($1, $2, $3, $4)
+			ON CONFLICT (order_id) DO UPDATE SET failures=excluded.failures, last_error=excluded.last_error,
+				payload=excluded.payload, created_at=now(), discarded_at=NULL`,
+			failure.OrderID, failures, failure.Error, payload)
+		if err != nil {
+			return false, fmt.Errorf("postgreSQL: failOrder %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("postgreSQL: failOrder %s", err)
+	}
+	return deadLettered, nil
+}
+
+// GetDeadLetters возвращает заказы, ожидающие решения администратора, от старых к новым.
+func (s *Storage) GetDeadLetters(ctx context.Context) ([]domain.DeadLetter, error) {
+	var letters []domain.DeadLetter
+	rows, err := s.DB.QueryContext(ctx, `SELECT d.order_id, o.status, d.failures, d.last_error, d.payload, d.created_at
+		FROM accrual_dead_letters d JOIN orders o ON o.order_id = d.order_id
+		WHERE d.discarded_at IS NULL ORDER BY d.created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: getDeadLetters %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var letter domain.DeadLetter
+		var payload sql.NullString
+		var createdAt time.Time
+		err := rows.Scan(&letter.OrderID, &letter.Status, &letter.Failures, &letter.LastError, &payload, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("postgreSQL: getDeadLetters %s", err)
+		}
+		letter.Payload = payload.String
+		letter.CreatedAt = createdAt.Format(time.RFC3339)
+		letters = append(letters, letter)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: getDeadLetters %s", err)
+	}
+
+	if len(letters) == 0 {
+		return nil, domain.ErrNoData
+	}
+
+	return letters, nil
+}
+
+// RetryDeadLetter убирает заказ из accrual_dead_letters, сбрасывает счётчики сбоев и проверок
+// и возвращает заказ в очередь опроса.
+func (s *Storage) RetryDeadLetter(ctx context.Context, orderID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: retryDeadLetter %s", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM accrual_dead_letters WHERE order_id=$1", orderID)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: retryDeadLetter %s", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgreSQL: retryDeadLetter %s", err)
+	}
+	if rowsAffected == 0 {
+		return domain.ErrDeadLetterNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE orders SET failures=0, attempts=0, next_check_at=now(), locked_by=NULL, locked_until=NULL WHERE order_id=$1", orderID)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: retryDeadLetter %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgreSQL: retryDeadLetter %s", err)
+	}
+	return nil
+}
+
+// DiscardDeadLetter убирает заказ из списка ожидающих решения. Заказ остаётся в текущем статусе
+// и больше не опрашивается, пока администратор не вызовет RetryDeadLetter.
+func (s *Storage) DiscardDeadLetter(ctx context.Context, orderID string) error {
+	result, err := s.DB.ExecContext(ctx, "UPDATE accrual_dead_letters SET discarded_at=now() WHERE order_id=$1 AND discarded_at IS NULL", orderID)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: discardDeadLetter %s", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgreSQL: discardDeadLetter %s", err)
+	}
+	if rowsAffected == 0 {
+		return domain.ErrDeadLetterNotFound
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+)
+
+// TestRetryDeadLetter проверяет, что повтор убирает заказ из accrual_dead_letters и сбрасывает его счётчики.
+func TestRetryDeadLetter(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "retry")
+	addOrder(t, storage, userID, "retry", time.Now())
+	deadLetter(t, storage, "retry")
+
+	if err := storage.RetryDeadLetter(ctx, "retry"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.GetDeadLetters(ctx); !errors.Is(err, domain.ErrNoData) {
+		t.Errorf("GetDeadLetters error = %v, want %v", err, domain.ErrNoData)
+	}
+	var failures, attempts int
+	err := storage.DB.QueryRowContext(ctx, "SELECT failures, attempts FROM orders WHERE order_id=$1", "retry").
+		Scan(&failures, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 || attempts != 0 {
+		t.Errorf("failures = %d, attempts = %d, want 0 and 0", failures, attempts)
+	}
+
+	if err := storage.RetryDeadLetter(ctx, "retry"); !errors.Is(err, domain.ErrDeadLetterNotFound) {
+		t.Errorf("second retry error = %v, want %v", err, domain.ErrDeadLetterNotFound)
+	}
+	if err := storage.RetryDeadLetter(ctx, "unknown"); !errors.Is(err, domain.ErrDeadLetterNotFound) {
+		t.Errorf("unknown order retry error = %v, want %v", err, domain.ErrDeadLetterNotFound)
+	}
+}
+
+// TestDiscardDeadLetter проверяет, что отклонённый заказ пропадает из списка и не отклоняется повторно.
+func TestDiscardDeadLetter(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "discard")
+	addOrder(t, storage, userID, "discard", time.Now())
+	deadLetter(t, storage, "discard")
+
+	letters, err := storage.GetDeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].OrderID != "discard" || letters[0].Failures != 2 {
+		t.Fatalf("dead letters = %+v, want discard with 2 failures", letters)
+	}
+
+	if err := storage.DiscardDeadLetter(ctx, "discard"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.GetDeadLetters(ctx); !errors.Is(err, domain.ErrNoData) {
+		t.Errorf("GetDeadLetters error = %v, want %v", err, domain.ErrNoData)
+	}
+	if err := storage.DiscardDeadLetter(ctx, "discard"); !errors.Is(err, domain.ErrDeadLetterNotFound) {
+		t.Errorf("second discard error = %v, want %v", err, domain.ErrDeadLetterNotFound)
+	}
+}
+
+// deadLetter переносит заказ в accrual_dead_letters двумя сбоями при maxFailures = 2.
+func deadLetter(t *testing.T, storage *repository.Storage, orderID string) {
+	t.Helper()
+	failure := domain.OrderFailure{
+		OrderID:     orderID,
+		Error:       "invalid accrual",
+		Payload:     []byte(`{"order":"` + orderID + `","status":"PROCESSED","accrual":-1}`),
+		NextCheckAt: time.Now(),
+	}
+	for i, want := range []bool{false, true} {
+		deadLettered, err := storage.FailOrder(context.Background(), "", failure, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deadLettered != want {
+			t.Fatalf("failure %d dead-lettered = %v, want %v", i+1, deadLettered, want)
+		}
+	}
+}
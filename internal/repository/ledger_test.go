@@ -0,0 +1,154 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+)
+
+// TestLedgerAccrual проверяет, что обработанный заказ начисляется одной записью журнала,
+// а повторная доставка того же статуса не начисляет баллы второй раз.
+func TestLedgerAccrual(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "accrual")
+	addOrder(t, storage, userID, "accrued", time.Now())
+
+	processed := []domain.OrderUpdate{{
+		Order:       domain.ScoringSystem{OrderID: "accrued", Status: domain.Processed, Bonuses: decimal.RequireFromString("729.98")},
+		NextCheckAt: time.Now(),
+	}}
+	for i := 0; i < 2; i++ {
+		if _, err := storage.UpdateOrders(ctx, "", processed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		entries int
+		amount  decimal.Decimal
+	)
+	err := storage.DB.QueryRowContext(ctx, "SELECT count(*), COALESCE(SUM(amount), 0) FROM ledger_entries WHERE kind=$1 AND reference=$2",
+		domain.LedgerAccrual, "accrued").Scan(&entries, &amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 1 || !amount.Equal(decimal.RequireFromString("729.98")) {
+		t.Errorf("accrual entries = %d with %s, want 1 with 729.98", entries, amount)
+	}
+
+	balance, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.Equal(decimal.RequireFromString("729.98")) {
+		t.Errorf("balance = %s, want 729.98", balance.Bonuses)
+	}
+}
+
+// TestLedgerAmountSign проверяет ограничение знака суммы для каждого вида записи.
+func TestLedgerAmountSign(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "sign")
+
+	tests := []struct {
+		kind   domain.LedgerKind
+		amount string
+		valid  bool
+	}{
+		{domain.LedgerAccrual, "10", true},
+		{domain.LedgerAccrual, "-10", false},
+		{domain.LedgerAccrual, "0", false},
+		{domain.LedgerWithdrawal, "-10", true},
+		{domain.LedgerWithdrawal, "10", false},
+		{domain.LedgerReversal, "10", true},
+		{domain.LedgerReversal, "-10", false},
+		{domain.LedgerAdjustment, "-10", true},
+		{domain.LedgerAdjustment, "10", true},
+		{domain.LedgerAdjustment, "0", false},
+	}
+	for i, tt := range tests {
+		_, err := storage.DB.ExecContext(ctx, "INSERT INTO ledger_entries (user_id, kind, amount, reference) values ($1, $2, $3, $4)",
+			userID, tt.kind, tt.amount, strconv.Itoa(i))
+		var pgErr *pgconn.PgError
+		violated := errors.As(err, &pgErr) && pgErr.ConstraintName == "ledger_entries_amount_sign"
+		if err != nil && !violated {
+			t.Fatalf("%s %s: %v", tt.kind, tt.amount, err)
+		}
+		if violated == tt.valid {
+			t.Errorf("%s %s accepted = %v, want %v", tt.kind, tt.amount, !violated, tt.valid)
+		}
+	}
+}
+
+// TestRepairBalancesFromLedger проверяет, что ремонт восстанавливает баланс, накопленный начислением,
+// списаниями и отменой списания, и не трогает верные балансы.
+func TestRepairBalancesFromLedger(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "history")
+	repositorytest.Credit(t, storage, userID, "1000")
+	untouched := repositorytest.AddUser(t, storage, "untouched")
+	repositorytest.Credit(t, storage, untouched, "5")
+
+	withdraw(t, storage, userID, "2377225624", 300)
+	withdraw(t, storage, userID, "12345678903", 200)
+	if _, err := storage.ReverseWithdraw(ctx, "12345678903"); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !want.Bonuses.Equal(decimal.NewFromInt(700)) || !want.Withdraw.Equal(decimal.NewFromInt(300)) {
+		t.Fatalf("balance before repair = %+v, want 700 current and 300 withdrawn", want)
+	}
+
+	if _, err := storage.DB.ExecContext(ctx, "UPDATE balances SET current=0, withdrawn=0 WHERE user_id=$1", userID); err != nil {
+		t.Fatal(err)
+	}
+	repaired, err := storage.RepairBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != 1 {
+		t.Errorf("repaired = %d, want 1", repaired)
+	}
+
+	got, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Bonuses.Equal(want.Bonuses.Decimal) || !got.Withdraw.Equal(want.Withdraw.Decimal) {
+		t.Errorf("repaired balance = %+v, want %+v", got, want)
+	}
+}
+
+func withdraw(t *testing.T, storage *repository.Storage, userID int64, orderID string, sum int64) {
+	t.Helper()
+	w := domain.Withdraw{
+		OrderID:    orderID,
+		Bonuses:    domain.NewAmount(decimal.NewFromInt(sum)),
+		UploadedAt: time.Now().Format(time.RFC3339),
+		UserID:     userID,
+	}
+	err := storage.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := storage.Withdraw(ctx, w); err != nil {
+			return err
+		}
+		return storage.DebitBalance(ctx, userID, w.Bonuses.Decimal)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
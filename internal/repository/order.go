@@ -2,13 +2,21 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/shopspring/decimal"
 )
 
 func (s *Storage) AddOrder(ctx context.Context, order domain.Order) error {
-	result, err := s.DB.ExecContext(ctx, "INSERT INTO orders (order_id, status, uploaded_at, bonuses, user_id) values ($1, $2, $3, $4, $5) on conflict (order_id) do nothing",
+	result, err := s.DB.ExecContext(ctx, `WITH inserted AS (
+			INSERT INTO orders (order_id, status, uploaded_at, bonuses, user_id) values ($1, $2, $3, $4, $5) on conflict (order_id) do nothing
+			RETURNING order_id, status, uploaded_at
+		)
+		INSERT INTO order_status_history (order_id, status_to, changed_at) SELECT order_id, status, uploaded_at FROM inserted`,
 		order.OrderID, order.Status, order.UploadedAt, order.Bonuses, order.UserID)
 	if err != nil {
 		return fmt.Errorf("postgreSQL: addOrder %s", err)
@@ -45,6 +53,20 @@ func (s *Storage) checkOrder(ctx context.Context, order domain.Order) (int64, er
 	return userID, nil
 }
 
+// GetOrder возвращает заказ по номеру независимо от владельца.
+func (s *Storage) GetOrder(ctx context.Context, orderID string) (domain.Order, error) {
+	var order domain.Order
+	err := s.DB.QueryRowContext(ctx, "SELECT order_id, status, uploaded_at, bonuses, user_id FROM orders WHERE order_id=$1", orderID).
+		Scan(&order.OrderID, &order.Status, &order.UploadedAt, &order.Bonuses, &order.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Order{}, domain.ErrOrderNotFound
+	}
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("postgreSQL: getOrder %s", err)
+	}
+	return order, nil
+}
+
 func (s *Storage) GetAllOrders(ctx context.Context, userID int64) ([]domain.Order, error) {
 	var orders []domain.Order
 	rows, err := s.DB.QueryContext(ctx, "SELECT order_id, status, uploaded_at, bonuses FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC", userID)
@@ -73,3 +95,46 @@ func (s *Storage) GetAllOrders(ctx context.Context, userID int64) ([]domain.Orde
 
 	return orders, nil
 }
+
+// GetOrderHistory возвращает историю статусов заказа пользователя в хронологическом порядке.
+func (s *Storage) GetOrderHistory(ctx context.Context, userID int64, orderID string) ([]domain.OrderStatusChange, error) {
+	var history []domain.OrderStatusChange
+	rows, err := s.DB.QueryContext(ctx, `SELECT h.status_from, h.status_to, h.bonuses, h.payload, h.changed_at
+		FROM order_status_history h JOIN orders o ON o.order_id = h.order_id
+		WHERE o.order_id = $1 AND o.user_id = $2 ORDER BY h.changed_at, h.id`, orderID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: getOrderHistory %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change domain.OrderStatusChange
+		var from sql.NullString
+		var bonuses decimal.NullDecimal
+		var payload []byte
+		var changedAt time.Time
+		err := rows.Scan(&from, &change.To, &bonuses, &payload, &changedAt)
+		if err != nil {
+			return nil, fmt.Errorf("postgreSQL: getOrderHistory %s", err)
+		}
+		change.From = domain.OrderStatus(from.String)
+		if bonuses.Valid && !bonuses.Decimal.IsZero() {
+			amount := domain.NewAmount(bonuses.Decimal)
+			change.Bonuses = &amount
+		}
+		change.Payload = payload
+		change.ChangedAt = changedAt.Format(time.RFC3339)
+		history = append(history, change)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: getOrderHistory %s", err)
+	}
+
+	if len(history) == 0 {
+		return nil, domain.ErrOrderNotFound
+	}
+
+	return history, nil
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// GetProcessedOrders возвращает до limit заказов в статусе PROCESSED, загруженных не раньше since,
+// с номерами больше after в порядке возрастания номера, чтобы сверку можно было вести страницами.
+func (s *Storage) GetProcessedOrders(ctx context.Context, after string, since time.Time, limit int) ([]domain.Order, error) {
+	var orders []domain.Order
+	rows, err := s.DB.QueryContext(ctx, `SELECT order_id, status, uploaded_at, bonuses, user_id FROM orders
+		WHERE status = 'PROCESSED' AND order_id > $1 AND uploaded_at >= $2
+		ORDER BY order_id LIMIT $3`, after, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: getProcessedOrders %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order domain.Order
+		err := rows.Scan(&order.OrderID, &order.Status, &order.UploadedAt, &order.Bonuses, &order.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("postgreSQL: getProcessedOrders %s", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgreSQL: getProcessedOrders %s", err)
+	}
+
+	return orders, nil
+}
+
+// AddDiscrepancy записывает найденное сверкой расхождение в отчёт.
+func (s *Storage) AddDiscrepancy(ctx context.Context, discrepancy domain.Discrepancy) error {
+	if err := addDiscrepancy(ctx, s.DB, discrepancy); err != nil {
+		return fmt.Errorf("postgreSQL: addDiscrepancy %s", err)
+	}
+	return nil
+}
+
+// CorrectOrder исправляет статус и начисление заказа по ответу системы расчёта в обход
+// правил переходов и записывает исправление в историю статусов и в отчёт сверки.
+// Разница в начисленных баллах записывается в журнал как корректировка и применяется к балансу.
+// Если заказ успел измениться после сверки, возвращает domain.ErrStatusTransition, если баланс
+// пользователя после исправления стал бы отрицательным — domain.ErrNegativeCorrection.
+func (s *Storage) CorrectOrder(ctx context.Context, discrepancy domain.Discrepancy) error {
+	order := domain.ScoringSystem{
+		OrderID: discrepancy.OrderID,
+		Status:  discrepancy.RemoteStatus,
+		Bonuses: discrepancy.RemoteBonuses.Decimal,
+		Payload: discrepancy.Payload,
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE orders SET status=$1, bonuses=$2, provider=$3 WHERE order_id=$4 AND status=$5",
+		order.Status, order.Bonuses, discrepancy.Provider, order.OrderID, discrepancy.StoredStatus)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+	if rowsAffected == 0 {
+		return s.updateOrderError(ctx, "", order)
+	}
+
+	if err := addStatusHistory(ctx, tx, order.OrderID, discrepancy.StoredStatus, order); err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+
+	// Разница списывается, только если баланс её покрывает: иначе исправление отклоняется,
+	// а расхождение остаётся в отчёте для администратора.
+	amount := credited(order.Status, order.Bonuses).Sub(credited(discrepancy.StoredStatus, discrepancy.StoredBonuses.Decimal))
+	if !amount.IsZero() {
+		result, err := tx.ExecContext(ctx, `WITH adjusted AS (
+				UPDATE balances b SET current = b.current + $2, version = b.version + 1, updated_at = now()
+				FROM orders o WHERE o.order_id = $3 AND b.user_id = o.user_id AND b.current + $2 >= 0
+				RETURNING b.user_id
+			)
+			INSERT INTO ledger_entries (user_id, kind, amount, reference)
+			SELECT user_id, $1, $2, $3 FROM adjusted`,
+			domain.LedgerAdjustment, amount, order.OrderID)
+		if err != nil {
+			return fmt.Errorf("postgreSQL: correctOrder %s", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("postgreSQL: correctOrder %s", err)
+		}
+		if rowsAffected == 0 {
+			return domain.ErrNegativeCorrection
+		}
+	}
+
+	discrepancy.Corrected = true
+	if err := addDiscrepancy(ctx, tx, discrepancy); err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgreSQL: correctOrder %s", err)
+	}
+	return nil
+}
+
+// credited возвращает сумму, начисленную пользователю за заказ в статусе status.
+func credited(status domain.OrderStatus, bonuses decimal.Decimal) decimal.Decimal {
+	if status != domain.Processed {
+		return decimal.Zero
+	}
+	return bonuses
+}
+
+// ResolveDiscrepancy закрывает открытое расхождение по заказу, если сверка больше его не находит.
+func (s *Storage) ResolveDiscrepancy(ctx context.Context, orderID string) error {
+	if err := resolveDiscrepancy(ctx, s.DB, orderID); err != nil {
+		return fmt.Errorf("postgreSQL: resolveDiscrepancy %s", err)
+	}
+	return nil
+}
+
+// addDiscrepancy обновляет открытое расхождение по заказу или открывает новое, чтобы ежедневная сверка
+// не дублировала его. Исправленное расхождение записывается закрытым и закрывает открытое.
+func addDiscrepancy(ctx context.Context, db querier, d domain.Discrepancy) error {
+	if d.Corrected {
+		if err := resolveDiscrepancy(ctx, db, d.OrderID); err != nil {
+			return err
+		}
+	}
+
+	var remoteStatus, remoteBonuses any
+	if d.RemoteStatus != "" {
+		remoteStatus, remoteBonuses = d.RemoteStatus, d.RemoteBonuses
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO accrual_discrepancies
+		(order_id, provider, stored_status, stored_bonuses, remote_status, remote_bonuses, payload, corrected, resolved_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $8 THEN now() END)
+		ON CONFLICT (order_id) WHERE resolved_at IS NULL DO UPDATE SET provider=excluded.provider,
+			stored_status=excluded.stored_status, stored_bonuses=excluded.stored_bonuses,
+			remote_status=excluded.remote_status, remote_bonuses=excluded.remote_bonuses,
+			payload=excluded.payload, detected_at=now()`,
+		d.OrderID, d.Provider, d.StoredStatus, d.StoredBonuses, remoteStatus, remoteBonuses, d.Payload, d.Corrected)
+	return err
+}
+
+func resolveDiscrepancy(ctx context.Context, db querier, orderID string) error {
+	_, err := db.ExecContext(ctx, "UPDATE accrual_discrepancies SET resolved_at=now() WHERE order_id=$1 AND resolved_at IS NULL", orderID)
+	return err
+}
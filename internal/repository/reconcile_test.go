@@ -0,0 +1,122 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	"github.com/shopspring/decimal"
+)
+
+// TestCorrectOrderNegativeBalance проверяет, что исправление PROCESSED -> INVALID не уводит баланс в минус,
+// а при достаточном балансе списывает начисление корректировкой.
+func TestCorrectOrderNegativeBalance(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "correct")
+	repositorytest.Credit(t, storage, userID, "20")
+	processOrder(t, storage, userID, "spent", 100)
+
+	discrepancy := domain.Discrepancy{
+		OrderID:       "spent",
+		Provider:      "test",
+		StoredStatus:  domain.Processed,
+		StoredBonuses: domain.NewAmount(decimal.NewFromInt(100)),
+		RemoteStatus:  domain.Invalid,
+	}
+	if err := storage.CorrectOrder(ctx, discrepancy); !errors.Is(err, domain.ErrNegativeCorrection) {
+		t.Fatalf("CorrectOrder error = %v, want %v", err, domain.ErrNegativeCorrection)
+	}
+	if order, err := storage.GetOrder(ctx, "spent"); err != nil || order.Status != domain.Processed {
+		t.Errorf("order = %+v, %v, want it to stay PROCESSED", order, err)
+	}
+
+	repositorytest.Credit(t, storage, userID, "80")
+	if err := storage.CorrectOrder(ctx, discrepancy); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := storage.Balance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Bonuses.IsZero() {
+		t.Errorf("balance = %s, want 0", balance.Bonuses)
+	}
+}
+
+// TestAddDiscrepancyUpsert проверяет, что повторная сверка обновляет открытое расхождение,
+// а исправление и ResolveDiscrepancy закрывают его.
+func TestAddDiscrepancyUpsert(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "upsert")
+	processOrder(t, storage, userID, "nightly", 100)
+
+	discrepancy := domain.Discrepancy{
+		OrderID:       "nightly",
+		Provider:      "test",
+		StoredStatus:  domain.Processed,
+		StoredBonuses: domain.NewAmount(decimal.NewFromInt(100)),
+		RemoteStatus:  domain.Processed,
+		RemoteBonuses: domain.NewAmount(decimal.NewFromInt(90)),
+	}
+	for _, remote := range []int64{90, 80} {
+		discrepancy.RemoteBonuses = domain.NewAmount(decimal.NewFromInt(remote))
+		if err := storage.AddDiscrepancy(ctx, discrepancy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var open int
+	var remote decimal.Decimal
+	err := storage.DB.QueryRowContext(ctx, `SELECT count(*), max(remote_bonuses) FROM accrual_discrepancies
+		WHERE order_id=$1 AND resolved_at IS NULL`, "nightly").Scan(&open, &remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open != 1 || !remote.Equal(decimal.NewFromInt(80)) {
+		t.Errorf("open discrepancies = %d with remote accrual %s, want 1 with 80", open, remote)
+	}
+
+	if err := storage.ResolveDiscrepancy(ctx, "nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if n := openDiscrepancies(t, storage, "nightly"); n != 0 {
+		t.Errorf("open discrepancies after resolve = %d, want 0", n)
+	}
+
+	if err := storage.AddDiscrepancy(ctx, discrepancy); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.CorrectOrder(ctx, discrepancy); err != nil {
+		t.Fatal(err)
+	}
+	if n := openDiscrepancies(t, storage, "nightly"); n != 0 {
+		t.Errorf("open discrepancies after correction = %d, want 0", n)
+	}
+}
+
+func processOrder(t *testing.T, storage *repository.Storage, userID int64, orderID string, bonuses int64) {
+	t.Helper()
+	addOrder(t, storage, userID, orderID, time.Now())
+	_, err := storage.DB.ExecContext(context.Background(), "UPDATE orders SET status=$1, bonuses=$2 WHERE order_id=$3",
+		domain.Processed, bonuses, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openDiscrepancies(t *testing.T, storage *repository.Storage, orderID string) int {
+	t.Helper()
+	var open int
+	err := storage.DB.QueryRowContext(context.Background(),
+		"SELECT count(*) FROM accrual_discrepancies WHERE order_id=$1 AND resolved_at IS NULL", orderID).Scan(&open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return open
+}
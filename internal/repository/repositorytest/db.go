@@ -0,0 +1,86 @@
+// Package repositorytest поднимает хранилище в отдельной схеме тестовой базы PostgreSQL
+// для тестов, которым нужна настоящая база.
+package repositorytest
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/pressly/goose/v3"
+)
+
+// EnvDatabaseURI — переменная окружения с адресом тестовой базы. Без неё тесты с базой пропускаются.
+const EnvDatabaseURI = "TEST_DATABASE_URI"
+
+// New создаёт схему со случайным именем, применяет к ней миграции и возвращает хранилище,
+// работающее только в этой схеме. Схема удаляется по завершении теста.
+func New(t testing.TB) *repository.Storage {
+	t.Helper()
+
+	uri := os.Getenv(EnvDatabaseURI)
+	if uri == "" {
+		t.Skipf("%s is not set", EnvDatabaseURI)
+	}
+
+	admin, err := sql.Open("pgx", uri)
+	if err != nil {
+		t.Fatalf("repositorytest: open %s", err)
+	}
+	schema := fmt.Sprintf("test_%d", rand.Uint64())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("repositorytest: create schema %s", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("repositorytest: drop schema %s", err)
+		}
+		admin.Close()
+	})
+
+	dsn, err := withSearchPath(uri, schema)
+	if err != nil {
+		t.Fatalf("repositorytest: %s", err)
+	}
+	db, err := goose.OpenDBWithDriver("pgx", dsn)
+	if err != nil {
+		t.Fatalf("repositorytest: open %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	goose.SetLogger(goose.NopLogger())
+	if err := goose.Up(db, migrationsDir()); err != nil {
+		t.Fatalf("repositorytest: migrate %s", err)
+	}
+
+	return &repository.Storage{DB: db}
+}
+
+// withSearchPath направляет все соединения в схему schema.
+func withSearchPath(uri, schema string) (string, error) {
+	if !strings.Contains(uri, "://") {
+		return uri + " search_path=" + schema, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "..", "migrations")
+}
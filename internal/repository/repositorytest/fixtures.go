@@ -0,0 +1,40 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository"
+)
+
+// AddUser регистрирует пользователя login и возвращает его id.
+func AddUser(t testing.TB, storage *repository.Storage, login string) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := storage.Create(ctx, domain.User{Login: login, Password: "secret", RegisteredAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	var userID int64
+	if err := storage.DB.QueryRowContext(ctx, "SELECT id FROM users WHERE login=$1", login).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// Credit начисляет пользователю amount баллов записью журнала и пересчитывает баланс.
+func Credit(t testing.TB, storage *repository.Storage, userID int64, amount string) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := storage.DB.ExecContext(ctx, "INSERT INTO ledger_entries (user_id, kind, amount, reference) values ($1, $2, $3, $4)",
+		userID, domain.LedgerAccrual, amount, "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.RepairBalances(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
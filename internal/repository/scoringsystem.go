@@ -2,39 +2,310 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
 )
 
-func (s *Storage) GetOrderStatus(ctx context.Context) ([]string, error) {
-	var orderID []string
-	rows, err := s.DB.QueryContext(ctx, "SELECT order_id FROM orders WHERE status NOT IN ('PROCESSED', 'INVALID') LIMIT 15")
+// GetOrderStatus захватывает до limit необработанных заказов, срок проверки которых наступил,
+// в аренду на время lease. Заказы, уже арендованные другим экземпляром, пропускаются, пока аренда не истечёт.
+// Заказы из accrual_dead_letters не захватываются. Первыми захватываются заказы,
+// поднятые администратором, затем недавно загруженные, чтобы застрявшие заказы не задерживали новые.
+func (s *Storage) GetOrderStatus(ctx context.Context, owner string, lease time.Duration, limit int) ([]domain.PendingOrder, error) {
+	var orders []domain.PendingOrder
+	rows, err := s.DB.QueryContext(ctx, `UPDATE orders SET locked_by = $1, locked_until = now() + make_interval(secs => $2)
+		WHERE order_id IN (
+			SELECT order_id FROM orders
+			WHERE status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED') AND next_check_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+				AND NOT EXISTS (SELECT 1 FROM accrual_dead_letters d WHERE d.order_id = orders.order_id)
+			ORDER BY priority DESC, uploaded_at DESC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING order_id, status, attempts, uploaded_at`, owner, lease.Seconds(), limit)
 	if err != nil {
 		return nil, fmt.Errorf("postgreSQL: getOrderStatus %s", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var id string
-		err := rows.Scan(&id)
+		var order domain.PendingOrder
+		err := rows.Scan(&order.OrderID, &order.Status, &order.Attempts, &order.UploadedAt)
 		if err != nil {
 			return nil, fmt.Errorf("postgreSQL: getOrderStatus %s", err)
 		}
-		orderID = append(orderID, id)
+		orders = append(orders, order)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("postgreSQL: getOrderStatus %s", err)
 	}
 
-	return orderID, nil
+	return orders, nil
+}
+
+// UpdateOrder сохраняет расчёт, снимает аренду и назначает следующую проверку на nextCheckAt.
+// Заказ обновляется, только если переход из текущего статуса в order.Status допустим,
+// иначе возвращается domain.ErrStatusTransition.
+// Если аренда owner уже истекла и заказ захвачен другим экземпляром, возвращает domain.ErrOrderLeaseLost.
+// Пустой owner означает обновление, присланное самой системой расчёта: аренда не проверяется,
+// а повтор текущего статуса не меняет заказ и возвращает domain.ErrOrderUnchanged, чтобы повторённый
+// callback не снимал чужую аренду и не сдвигал расписание проверок.
+func (s *Storage) UpdateOrder(ctx context.Context, owner string, order domain.ScoringSystem, nextCheckAt time.Time) error {
+	rejected, err := s.UpdateOrders(ctx, owner, []domain.OrderUpdate{{Order: order, NextCheckAt: nextCheckAt}})
+	if err != nil {
+		return err
+	}
+	return rejected[order.OrderID]
+}
+
+// UpdateOrders сохраняет ответы системы расчёта по нескольким заказам одним запросом в одной транзакции
+// по тем же правилам, что и UpdateOrder, и запоминает провайдера, приславшего ответ.
+// Начисление за заказ, перешедший в PROCESSED, записывается в журнал баллов и сразу прибавляется к балансу
+// пользователя с увеличением его версии, чтобы параллельное списание заметило изменение. Заказы, которые не удалось обновить, возвращаются в rejected с причиной.
+func (s *Storage) UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	latest := make(map[string]domain.OrderUpdate, len(updates))
+	var (
+		ids        []string
+		statuses   []string
+		bonuses    []string
+		payloads   []*string
+		nextChecks []time.Time
+		providers  []string
+	)
+	for _, update := range updates {
+		if _, ok := latest[update.Order.OrderID]; !ok {
+			ids = append(ids, update.Order.OrderID)
+		}
+		latest[update.Order.OrderID] = update
+	}
+	for _, id := range ids {
+		order := latest[id].Order
+		statuses = append(statuses, string(order.Status))
+		bonuses = append(bonuses, order.Bonuses.String())
+		nextChecks = append(nextChecks, latest[id].NextCheckAt)
+		providers = append(providers, order.Provider)
+		if order.Payload != nil {
+			payload := string(order.Payload)
+			payloads = append(payloads, &payload)
+		} else {
+			payloads = append(payloads, nil)
+		}
+	}
+	transitionsFrom, transitionsTo := domain.Transitions()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgreSQL: updateOrders %s", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `WITH v AS (
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[], $9::text[])
+				AS v(order_id, status, bonuses, payload, next_check_at, provider)
+		), t AS (
+			SELECT * FROM unnest($7::text[], $8::text[]) AS t(status_from, status_to)
+		), prev AS (
+			SELECT o.order_id, o.status FROM orders o JOIN v ON v.order_id = o.order_id
+			WHERE $6 = '' OR o.locked_by = $6
+			FOR UPDATE OF o
+		), upd AS (
+			UPDATE orders o SET status = v.status, bonuses = v.bonuses::numeric, attempts = o.attempts + 1, failures = 0, priority = 0,
+				next_check_at = v.next_check_at, locked_by = NULL, locked_until = NULL,
+				provider = COALESCE(NULLIF(v.provider, ''), o.provider)
+			FROM v
+				JOIN prev ON prev.order_id = v.order_id
+				JOIN t ON t.status_from = prev.status AND t.status_to = v.status
+			WHERE o.order_id = v.order_id AND NOT ($6 = '' AND prev.status = v.status)
+			RETURNING o.order_id, o.user_id, prev.status AS status_from, v.status AS status_to, v.bonuses, v.payload
+		), history AS (
+			INSERT INTO order_status_history (order_id, status_from, status_to, bonuses, payload)
+			SELECT order_id, status_from, status_to, bonuses::numeric, payload::jsonb FROM upd WHERE status_from <> status_to
+		), ledger AS (
+			INSERT INTO ledger_entries (user_id, kind, amount, reference)
+			SELECT user_id, 'accrual', bonuses::numeric, order_id FROM upd
+			WHERE status_to = 'PROCESSED' AND status_from <> 'PROCESSED' AND bonuses::numeric <> 0
+			RETURNING user_id, amount
+		), balance AS (
+			UPDATE balances b SET current = b.current + l.amount, version = b.version + 1, updated_at = now()
+			FROM (SELECT user_id, SUM(amount) AS amount FROM ledger GROUP BY user_id) l
+			WHERE b.user_id = l.user_id
+		)
+		SELECT order_id FROM upd`,
+		ids, statuses, bonuses, payloads, nextChecks, owner, statusList(transitionsFrom), statusList(transitionsTo), providers)
+	if err != nil {
+		return nil, updateOrdersError(err)
+	}
+	defer rows.Close()
+
+	updated := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("postgreSQL: updateOrders %s", err)
+		}
+		updated[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, updateOrdersError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, updateOrdersError(err)
+	}
+
+	rejected := make(map[string]error)
+	for _, id := range ids {
+		if !updated[id] {
+			rejected[id] = s.updateOrderError(ctx, owner, latest[id].Order)
+		}
+	}
+	return rejected, nil
+}
+
+// updateOrdersError помечает domain.ErrInvalidPayload ошибки, вызванные записываемыми данными:
+// неверный формат значения (класс 22) или нарушение ограничения (класс 23). Остальные ошибки,
+// например разрыв соединения или взаимоблокировка, не зависят от ответа и проходят при повторе.
+func updateOrdersError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")) {
+		return fmt.Errorf("%w: postgreSQL: updateOrders %s", domain.ErrInvalidPayload, err)
+	}
+	return fmt.Errorf("postgreSQL: updateOrders %s", err)
+}
+
+// RequeueOrder возвращает заказ из UNREGISTERED в NEW и сбрасывает счётчик проверок,
+// чтобы опрос системы расчёта начался заново.
+func (s *Storage) RequeueOrder(ctx context.Context, orderID string) error {
+	order := domain.ScoringSystem{OrderID: orderID, Status: domain.NewOrder}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: requeueOrder %s", err)
+	}
+	defer tx.Rollback()
+
+	var statusFrom domain.OrderStatus
+	err = tx.QueryRowContext(ctx, `UPDATE orders o SET status=$1, attempts=0, next_check_at=now(), locked_by=NULL, locked_until=NULL
+		FROM (SELECT order_id, status FROM orders WHERE order_id=$2 FOR UPDATE) prev
+		WHERE o.order_id=prev.order_id AND o.status = ANY($3)
+		RETURNING prev.status`,
+		order.Status, order.OrderID, statusList(domain.TransitionSources(order.Status))).
+		Scan(&statusFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.updateOrderError(ctx, "", order)
+	}
+	if err != nil {
+		return fmt.Errorf("postgreSQL: requeueOrder %s", err)
+	}
+
+	if err := addStatusHistory(ctx, tx, order.OrderID, statusFrom, order); err != nil {
+		return fmt.Errorf("postgreSQL: requeueOrder %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgreSQL: requeueOrder %s", err)
+	}
+	return nil
+}
+
+func addStatusHistory(ctx context.Context, tx *sql.Tx, orderID string, from domain.OrderStatus, order domain.ScoringSystem) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO order_status_history (order_id, status_from, status_to, bonuses, payload) values ($1, $2, $3, $4, $5)",
+		orderID, from, order.Status, order.Bonuses, order.Payload)
+	return err
 }
 
-func (s *Storage) UpdateOrder(ctx context.Context, order domain.ScoringSystem) error {
-	_, err := s.DB.ExecContext(ctx, "UPDATE orders SET status=$1, bonuses=$2 WHERE order_id=$3", order.Status, order.Bonuses, order.OrderID)
+// updateOrderError выясняет, почему UpdateOrder не изменил ни одной строки.
+// Повторно присланный окончательный статус с тем же начислением, а без owner — любой текущий статус
+// с тем же начислением, возвращает domain.ErrOrderUnchanged.
+func (s *Storage) updateOrderError(ctx context.Context, owner string, order domain.ScoringSystem) error {
+	var status domain.OrderStatus
+	var lockedBy sql.NullString
+	var bonuses decimal.NullDecimal
+	err := s.DB.QueryRowContext(ctx, "SELECT status, locked_by, bonuses FROM orders WHERE order_id=$1", order.OrderID).
+		Scan(&status, &lockedBy, &bonuses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrOrderNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("postgreSQL: updateOrder %s", err)
 	}
+
+	if owner != "" && lockedBy.String != owner {
+		return domain.ErrOrderLeaseLost
+	}
+	if status == order.Status && (status.IsTerminal() || owner == "") && bonuses.Decimal.Equal(order.Bonuses) {
+		return domain.ErrOrderUnchanged
+	}
+	return fmt.Errorf("%w: %s -> %s", domain.ErrStatusTransition, status, order.Status)
+}
+
+func statusList(statuses []domain.OrderStatus) []string {
+	list := make([]string, len(statuses))
+	for i, status := range statuses {
+		list[i] = string(status)
+	}
+	return list
+}
+
+// RescheduleOrder снимает аренду owner с заказа без изменения его статуса
+// и откладывает следующую проверку до nextCheckAt, засчитывая заказу проверку.
+func (s *Storage) RescheduleOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE orders SET attempts=attempts+1, priority=0, next_check_at=$1, locked_by=NULL, locked_until=NULL
+		WHERE order_id=$2 AND locked_by=$3`, nextCheckAt, orderID, owner)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: rescheduleOrder %s", err)
+	}
+	return nil
+}
+
+// PostponeOrder снимает аренду owner с заказа и откладывает проверку до nextCheckAt, не засчитывая её:
+// запрос в систему расчёта не отправлялся или не получил ответа о заказе.
+func (s *Storage) PostponeOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE orders SET next_check_at=$1, locked_by=NULL, locked_until=NULL
+		WHERE order_id=$2 AND locked_by=$3`, nextCheckAt, orderID, owner)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: postponeOrder %s", err)
+	}
 	return nil
 }
+
+// BumpOrder ставит необработанный заказ в начало очереди опроса и назначает проверку на сейчас.
+// Приоритет сбрасывается после следующей проверки. Для окончательного статуса возвращает domain.ErrOrderFinished.
+func (s *Storage) BumpOrder(ctx context.Context, orderID string) error {
+	result, err := s.DB.ExecContext(ctx, `UPDATE orders SET priority=1, next_check_at=now()
+		WHERE order_id=$1 AND status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED')`, orderID)
+	if err != nil {
+		return fmt.Errorf("postgreSQL: bumpOrder %s", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgreSQL: bumpOrder %s", err)
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var status domain.OrderStatus
+	err = s.DB.QueryRowContext(ctx, "SELECT status FROM orders WHERE order_id=$1", orderID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("postgreSQL: bumpOrder %s", err)
+	}
+	return fmt.Errorf("%w: %s", domain.ErrOrderFinished, status)
+}
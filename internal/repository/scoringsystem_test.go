@@ -0,0 +1,109 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	"github.com/shopspring/decimal"
+)
+
+// TestGetOrderStatusClaimOrder проверяет очерёдность захвата: сначала поднятые администратором,
+// затем недавно загруженные заказы; арендованные заказы другим экземпляром не захватываются.
+func TestGetOrderStatusClaimOrder(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "claim")
+
+	now := time.Now()
+	addOrder(t, storage, userID, "oldest", now.Add(-4*time.Hour))
+	addOrder(t, storage, userID, "old", now.Add(-3*time.Hour))
+	addOrder(t, storage, userID, "recent", now.Add(-2*time.Hour))
+	addOrder(t, storage, userID, "newest", now.Add(-time.Hour))
+	if err := storage.BumpOrder(ctx, "oldest"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		owner string
+		want  []string
+	}{
+		{"first", []string{"newest", "oldest"}},
+		{"second", []string{"old", "recent"}},
+		{"third", nil},
+	}
+	for _, tt := range tests {
+		claimed, err := storage.GetOrderStatus(ctx, tt.owner, time.Minute, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, order := range claimed {
+			got = append(got, order.OrderID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s claimed %v, want %v", tt.owner, got, tt.want)
+		}
+	}
+}
+
+func addOrder(t *testing.T, storage *repository.Storage, userID int64, orderID string, uploadedAt time.Time) {
+	t.Helper()
+
+	err := storage.AddOrder(context.Background(), domain.Order{
+		OrderID:    orderID,
+		Status:     domain.NewOrder,
+		Bonuses:    domain.NewAmount(decimal.Zero),
+		UploadedAt: uploadedAt.Format(time.RFC3339),
+		UserID:     userID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUpdateOrdersCallbackReplay проверяет, что повторённый callback с текущим статусом заказа
+// не снимает аренду опроса и не засчитывает проверку.
+func TestUpdateOrdersCallbackReplay(t *testing.T) {
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+	userID := repositorytest.AddUser(t, storage, "replay")
+	addOrder(t, storage, userID, "replay", time.Now())
+
+	processing := []domain.OrderUpdate{{Order: domain.ScoringSystem{OrderID: "replay", Status: domain.Processing}, NextCheckAt: time.Now()}}
+	rejected, err := storage.UpdateOrders(ctx, "", processing)
+	if err != nil || rejected["replay"] != nil {
+		t.Fatalf("first callback = %v, %v", rejected, err)
+	}
+	if claimed, err := storage.GetOrderStatus(ctx, "poller", time.Minute, 1); err != nil || len(claimed) != 1 {
+		t.Fatalf("claim = %v, %v", claimed, err)
+	}
+
+	rejected, err = storage.UpdateOrders(ctx, "", processing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(rejected["replay"], domain.ErrOrderUnchanged) {
+		t.Errorf("replayed callback error = %v, want %v", rejected["replay"], domain.ErrOrderUnchanged)
+	}
+
+	var (
+		lockedBy sql.NullString
+		attempts int
+	)
+	err = storage.DB.QueryRowContext(ctx, "SELECT locked_by, attempts FROM orders WHERE order_id=$1", "replay").Scan(&lockedBy, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockedBy.String != "poller" || attempts != 1 {
+		t.Errorf("after replay locked_by = %q, attempts = %d, want poller, 1", lockedBy.String, attempts)
+	}
+}
@@ -9,7 +9,11 @@ import (
 
 
 func (s *Storage) Create(ctx context.Context, user domain.User) error {
-	result, err := s.DB.ExecContext(ctx, "INSERT INTO users (login, password, registered_at) values ($1, $2, $3) on conflict (login) do nothing",
+	result, err := s.DB.ExecContext(ctx, `WITH inserted AS (
+			INSERT INTO users (login, password, registered_at) values ($1, $2, $3) on conflict (login) do nothing
+			RETURNING id
+		)
+		INSERT INTO balances (user_id) SELECT id FROM inserted`,
 		user.Login, user.Password, user.RegisteredAt)
 	if err != nil {
 		return fmt.Errorf("postgreSQL: create %s", err)
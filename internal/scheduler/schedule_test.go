@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestCronNext(t *testing.T) {
+	// 18 октября 2026 года — воскресенье.
+	sunday := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"daily", "0 3 * * *", sunday, time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", sunday.Add(7 * time.Minute), time.Date(2026, 10, 18, 12, 15, 0, 0, time.UTC)},
+		{"step from value", "10/20 * * * *", sunday.Add(31 * time.Minute), time.Date(2026, 10, 18, 12, 50, 0, 0, time.UTC)},
+		{"list", "5,35 * * * *", sunday.Add(10 * time.Minute), time.Date(2026, 10, 18, 12, 35, 0, 0, time.UTC)},
+		{"range", "30 1-3 * * *", time.Date(2026, 10, 18, 2, 40, 0, 0, time.UTC), time.Date(2026, 10, 18, 3, 30, 0, 0, time.UTC)},
+		{"range with step", "0 9-17/4 * * *", sunday, time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC)},
+		{"strictly after", "0 12 * * *", sunday, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		{"seconds are dropped", "1 12 * * *", sunday.Add(30 * time.Second), time.Date(2026, 10, 18, 12, 1, 0, 0, time.UTC)},
+		{"month rollover", "0 0 1 * *", sunday, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"year rollover", "0 0 1 1 *", sunday, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"short month is skipped", "0 0 31 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", sunday, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"day of week", "0 0 * * 3", sunday, time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", sunday, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week, week first", "0 0 25 * 3", sunday, time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week, month first", "0 0 19 * 5", sunday, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"day of month with any week day", "0 0 19 * *", time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), time.Date(2026, 11, 19, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", sunday, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	schedule, err := Parse(" @every 90s ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule != Every(90*time.Second) {
+		t.Errorf("Parse(@every 90s) = %v, want %v", schedule, Every(90*time.Second))
+	}
+
+	if _, err := Parse("0 3 * * *"); err != nil {
+		t.Errorf("Parse(cron) error = %v", err)
+	}
+
+	for _, spec := range []string{"@every 0s", "@every -1m", "@every soon", "@daily"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestAddRejectsNonPositiveInterval(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	s := New(nil, logger)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := s.Add(Job{Name: "poll", Schedule: Every(interval), Run: func(context.Context) error { return nil }})
+		if err == nil {
+			t.Errorf("Add(Every(%s)) succeeded", interval)
+		}
+	}
+}
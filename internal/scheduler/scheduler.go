@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/leader"
+	log "github.com/sirupsen/logrus"
+)
+
+// Job — периодическая задача.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Jitter сдвигает каждый запуск на случайную задержку в пределах [0, Jitter),
+	// чтобы экземпляры сервиса не запускали задачу одновременно.
+	Jitter time.Duration
+	// Timeout ограничивает один запуск, 0 — без ограничения.
+	Timeout time.Duration
+	// Singleton — задача выполняется только на экземпляре, выбранном лидером по её имени.
+	Singleton bool
+	Run       func(ctx context.Context) error
+}
+
+// JobStatus — сведения о последнем запуске задачи.
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Runs     int        `json:"runs"`
+	// Skipped — запуски, пропущенные из-за того, что предыдущий ещё не завершился.
+	Skipped int `json:"skipped"`
+}
+
+type entry struct {
+	job Job
+
+	mu       sync.Mutex
+	running  bool
+	nextRun  time.Time
+	lastRun  time.Time
+	duration time.Duration
+	err      error
+	runs     int
+	skipped  int
+}
+
+// Scheduler запускает зарегистрированные задачи по расписанию. Запуски одной задачи
+// не перекрываются: задача с расписанием Every отсчитывает интервал от завершения предыдущего запуска,
+// а для cron-расписания очередной запуск пропускается, если предыдущий ещё идёт.
+type Scheduler struct {
+	elector *leader.Elector
+	logger  *log.Logger
+
+	mu      sync.Mutex
+	entries []*entry
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// New создаёт планировщик. elector нужен только задачам с Singleton и может быть nil.
+func New(elector *leader.Elector, logger *log.Logger) *Scheduler {
+	return &Scheduler{
+		elector: elector,
+		logger:  logger,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add регистрирует задачу. Задачи добавляются до вызова Run.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("scheduler: job needs a name, a schedule and a run function")
+	}
+	// Нулевой интервал превратил бы задачу в цикл без пауз.
+	if every, ok := job.Schedule.(Every); ok && every <= 0 {
+		return fmt.Errorf("scheduler: job %s interval must be positive, got %s", job.Name, time.Duration(every))
+	}
+	if job.Singleton && s.elector == nil {
+		return fmt.Errorf("scheduler: singleton job %s needs a leader elector", job.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.job.Name == job.Name {
+			return fmt.Errorf("scheduler: duplicate job %s", job.Name)
+		}
+	}
+	s.entries = append(s.entries, &entry{job: job})
+	return nil
+}
+
+// Run запускает задачи по расписанию. Блокирует до отмены ctx или вызова Stop,
+// после чего дожидается завершения идущих запусков; их контекст при этом отменяется.
+func (s *Scheduler) Run(ctx context.Context) {
+	defer close(s.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			if e.job.Singleton {
+				s.elector.Run(ctx, e.job.Name, func(ctx context.Context) {
+					s.loop(ctx, e)
+				})
+				return
+			}
+			s.loop(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Stop останавливает планировщик и дожидается завершения идущих запусков.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(entries))
+	for _, e := range entries {
+		statuses = append(statuses, e.status())
+	}
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	var runs sync.WaitGroup
+	defer runs.Wait()
+
+	_, fixedDelay := e.job.Schedule.(Every)
+	for {
+		next := e.job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		if e.job.Jitter > 0 {
+			next = next.Add(rand.N(e.job.Jitter))
+		}
+		e.setNextRun(next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !e.start() {
+			s.logger.WithFields(log.Fields{"job": e.job.Name}).Debug("previous run is still in progress, skipping")
+			continue
+		}
+		if fixedDelay {
+			s.run(ctx, e)
+			continue
+		}
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			s.run(ctx, e)
+		}()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	if e.job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.job.Timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	err := e.job.Run(ctx)
+	e.finish(started, time.Since(started), err)
+	if err != nil {
+		s.logger.WithFields(log.Fields{"job": e.job.Name}).Error(err)
+	}
+}
+
+// start отмечает начало запуска. Возвращает false, если предыдущий запуск ещё идёт.
+func (e *entry) start() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running {
+		e.skipped++
+		return false
+	}
+	e.running = true
+	return true
+}
+
+func (e *entry) finish(started time.Time, duration time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.running = false
+	e.lastRun = started
+	e.duration = duration
+	e.err = err
+	e.runs++
+}
+
+func (e *entry) setNextRun(next time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextRun = next
+}
+
+func (e *entry) status() JobStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := JobStatus{
+		Name:    e.job.Name,
+		Running: e.running,
+		Runs:    e.runs,
+		Skipped: e.skipped,
+	}
+	if !e.nextRun.IsZero() {
+		nextRun := e.nextRun
+		status.NextRun = &nextRun
+	}
+	if !e.lastRun.IsZero() {
+		lastRun := e.lastRun
+		status.LastRun = &lastRun
+		status.Duration = e.duration.String()
+	}
+	if e.err != nil {
+		status.Error = e.err.Error()
+	}
+	return status
+}
@@ -7,26 +7,32 @@ import (
 	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
-	"github.com/amiosamu/gofemart/internal/repository"
 	"github.com/shopspring/decimal"
 )
 
 type BonusesRepository interface {
-	Balance(ctx context.Context, userID int64) (float32, error)
-	WithdrawBalance(ctx context.Context, userID int64) (float32, error)
+	Balance(ctx context.Context, userID int64) (domain.BalanceOutput, error)
 	Withdraw(ctx context.Context, withdraw domain.Withdraw) error
+	DebitBalance(ctx context.Context, userID int64, amount decimal.Decimal) error
 	Withdrawals(ctx context.Context, userID int64) ([]domain.Withdraw, error)
+	RepairBalances(ctx context.Context) (int64, error)
+	ReverseWithdraw(ctx context.Context, orderID string) (domain.Withdraw, error)
+}
+
+// Transactor выполняет fn в одной транзакции: методы репозитория, вызванные с контекстом fn, работают на ней.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type Bonuses struct {
-	repo    BonusesRepository
-	storage *repository.Storage
+	repo BonusesRepository
+	tx   Transactor
 }
 
-func NewBonuses(repo BonusesRepository, storage *repository.Storage) *Bonuses {
+func NewBonuses(repo BonusesRepository, tx Transactor) *Bonuses {
 	return &Bonuses{
-		repo:    repo,
-		storage: storage,
+		repo: repo,
+		tx:   tx,
 	}
 }
 
@@ -36,21 +42,10 @@ func (b *Bonuses) Balance(ctx context.Context) (*domain.BalanceOutput, error) {
 		return nil, errors.New("incorrect user id")
 	}
 
-	balanceUser, err := b.repo.Balance(ctx, userID)
-	if err != nil {
-		return nil, err
-	}
-
-	balanceWithdraws, err := b.repo.WithdrawBalance(ctx, userID)
+	balance, err := b.repo.Balance(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-
-	newBalanceUser := decimal.NewFromFloat32(balanceUser).Sub(decimal.NewFromFloat32(balanceWithdraws))
-
-	var balance domain.BalanceOutput
-	balance.Bonuses = float32(newBalanceUser.InexactFloat64())
-	balance.Withdraw = balanceWithdraws
 	return &balance, nil
 }
 
@@ -64,6 +59,10 @@ func (b *Bonuses) Withdraw(ctx context.Context, withdraw domain.Withdraw) error
 		return domain.ErrIncorrectOrder
 	}
 
+	if !withdraw.Bonuses.IsPositive() {
+		return domain.ErrIncorrectSum
+	}
+
 	userID, ok := ctx.Value(domain.UserIDKeyForContext).(int64)
 	if !ok {
 		return errors.New("incorrect user id")
@@ -76,37 +75,28 @@ func (b *Bonuses) Withdraw(ctx context.Context, withdraw domain.Withdraw) error
 		UserID:     userID,
 	}
 
-	// Начало транзакции
-	tx, err := b.storage.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	err = b.repo.Withdraw(ctx, with)
-	if err != nil {
-		return err
-	}
-
-	balanceUser, err := b.repo.Balance(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	balanceWithdraws, err := b.repo.WithdrawBalance(ctx, userID)
-	if err != nil {
-		return err
-	}
+	// Баланс проверяется и уменьшается под блокировкой его строки до конца транзакции, поэтому параллельные
+	// списания одного пользователя выполняются по очереди и не уводят его в минус.
+	// Списание, на которое не хватает баллов, откатывается.
+	return b.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := b.repo.Withdraw(ctx, with); err != nil {
+			return err
+		}
+		return b.repo.DebitBalance(ctx, userID, with.Bonuses.Decimal)
+	})
+}
 
-	sum := decimal.NewFromFloat32(balanceUser).Sub(decimal.NewFromFloat32(balanceWithdraws))
-	if sum.LessThan(decimal.Zero) {
-		tx.Rollback()
-		return domain.ErrNoBonuses
+// ReverseWithdraw отменяет списание по номеру заказа и возвращает баллы пользователю.
+func (b *Bonuses) ReverseWithdraw(ctx context.Context, orderID string) (domain.Withdraw, error) {
+	if !checkOrderNumber(orderID) {
+		return domain.Withdraw{}, domain.ErrIncorrectOrder
 	}
+	return b.repo.ReverseWithdraw(ctx, orderID)
+}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-	return nil
+// RepairBalances пересчитывает балансы пользователей по журналу баллов.
+func (b *Bonuses) RepairBalances(ctx context.Context) (int64, error) {
+	return b.repo.RepairBalances(ctx)
 }
 
 func (b *Bonuses) Withdrawals(ctx context.Context) ([]domain.Withdraw, error) {
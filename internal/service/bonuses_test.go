@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/repository/repositorytest"
+	"github.com/shopspring/decimal"
+)
+
+// TestBonusesWithdrawConcurrent списывает баллы одного пользователя из многих горутин сразу, по одному
+// запросу на горутину, и проверяет, что проходят ровно те списания, на которые хватает баланса,
+// баланс не уходит в минус и сходится с журналом баллов.
+func TestBonusesWithdrawConcurrent(t *testing.T) {
+	const withdrawals = 32
+
+	storage := repositorytest.New(t)
+	ctx := context.Background()
+
+	userID := repositorytest.AddUser(t, storage, "stress")
+	seed := decimal.RequireFromString("1000.50")
+	amount := decimal.RequireFromString("149.99")
+	repositorytest.Credit(t, storage, userID, seed.String())
+
+	bonuses := NewBonuses(storage, storage)
+	userCtx := context.WithValue(ctx, domain.UserIDKeyForContext, userID)
+	orders := orderNumbers(withdrawals)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		failures  []error
+	)
+	start := make(chan struct{})
+	for _, orderID := range orders {
+		wg.Add(1)
+		go func(orderID string) {
+			defer wg.Done()
+			<-start
+
+			err := bonuses.Withdraw(userCtx, domain.Withdraw{OrderID: orderID, Bonuses: domain.NewAmount(amount)})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, domain.ErrNoBonuses):
+			default:
+				failures = append(failures, err)
+			}
+		}(orderID)
+	}
+	close(start)
+	wg.Wait()
+
+	for _, err := range failures {
+		t.Errorf("unexpected withdraw error: %s", err)
+	}
+
+	want := int(seed.Div(amount).IntPart())
+	if succeeded != want {
+		t.Errorf("succeeded withdrawals = %d, want %d", succeeded, want)
+	}
+
+	var current, withdrawn, ledger decimal.Decimal
+	err := storage.DB.QueryRowContext(ctx, "SELECT current, withdrawn FROM balances WHERE user_id=$1", userID).Scan(&current, &withdrawn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.DB.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE user_id=$1", userID).Scan(&ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.IsNegative() {
+		t.Errorf("balance went negative: %s", current)
+	}
+	if !current.Equal(ledger) {
+		t.Errorf("balance %s does not match ledger sum %s", current, ledger)
+	}
+	spent := amount.Mul(decimal.NewFromInt(int64(want)))
+	if !current.Equal(seed.Sub(spent)) || !withdrawn.Equal(spent) {
+		t.Errorf("balance = %s/%s, want %s/%s", current, withdrawn, seed.Sub(spent), spent)
+	}
+
+	var rows int
+	if err := storage.DB.QueryRowContext(ctx, "SELECT count(*) FROM withdrawals WHERE user_id=$1", userID).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != want {
+		t.Errorf("withdrawal rows = %d, want %d", rows, want)
+	}
+}
+
+func TestBonusesWithdrawRejectsNonPositiveSum(t *testing.T) {
+	bonuses := NewBonuses(nil, nil)
+	ctx := context.WithValue(context.Background(), domain.UserIDKeyForContext, int64(1))
+	orderID := orderNumbers(1)[0]
+
+	for _, sum := range []string{"0", "-100"} {
+		err := bonuses.Withdraw(ctx, domain.Withdraw{OrderID: orderID, Bonuses: domain.NewAmount(decimal.RequireFromString(sum))})
+		if !errors.Is(err, domain.ErrIncorrectSum) {
+			t.Errorf("Withdraw(sum=%s) error = %v, want %v", sum, err, domain.ErrIncorrectSum)
+		}
+	}
+}
+
+// orderNumbers возвращает n номеров заказов, проходящих проверку по алгоритму Луна.
+func orderNumbers(n int) []string {
+	var numbers []string
+	for i := 1000000; len(numbers) < n; i++ {
+		if number := strconv.Itoa(i); checkOrderNumber(number) {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
@@ -7,11 +7,13 @@ import (
 	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/shopspring/decimal"
 )
 
 type OrderRepository interface {
 	AddOrder(ctx context.Context, order domain.Order) error
 	GetAllOrders(ctx context.Context, userID int64) ([]domain.Order, error)
+	GetOrderHistory(ctx context.Context, userID int64, orderID string) ([]domain.OrderStatusChange, error)
 }
 
 type Orders struct {
@@ -44,7 +46,7 @@ func (o *Orders) AddOrderID(ctx context.Context, orderID string) error {
 		OrderID:    orderID,
 		Status:     domain.NewOrder,
 		UploadedAt: time.Now().Format(time.RFC3339),
-		Bonuses:    0,
+		Bonuses:    domain.NewAmount(decimal.Zero),
 		UserID:     userID,
 	}
 
@@ -65,3 +67,13 @@ func (o *Orders) GetAllOrders(ctx context.Context) ([]domain.Order, error) {
 
 	return orders, nil
 }
+
+// GetOrderHistory выводит историю статусов заказа пользователя.
+func (o *Orders) GetOrderHistory(ctx context.Context, orderID string) ([]domain.OrderStatusChange, error) {
+	userID, ok := ctx.Value(domain.UserIDKeyForContext).(int64)
+	if !ok {
+		return nil, errors.New("incorrect user id")
+	}
+
+	return o.repo.GetOrderHistory(ctx, userID, orderID)
+}
@@ -2,13 +2,29 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
 )
 
 type ScoringSystemRepository interface {
-	GetOrderStatus(ctx context.Context) ([]string, error)
-	UpdateOrder(ctx context.Context, order domain.ScoringSystem) error
+	GetOrderStatus(ctx context.Context, owner string, lease time.Duration, limit int) ([]domain.PendingOrder, error)
+	UpdateOrder(ctx context.Context, owner string, order domain.ScoringSystem, nextCheckAt time.Time) error
+	UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error)
+	RescheduleOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error
+	PostponeOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error
+	RequeueOrder(ctx context.Context, orderID string) error
+	GetOrder(ctx context.Context, orderID string) (domain.Order, error)
+	BumpOrder(ctx context.Context, orderID string) error
+	GetProcessedOrders(ctx context.Context, after string, since time.Time, limit int) ([]domain.Order, error)
+	AddDiscrepancy(ctx context.Context, discrepancy domain.Discrepancy) error
+	ResolveDiscrepancy(ctx context.Context, orderID string) error
+	CorrectOrder(ctx context.Context, discrepancy domain.Discrepancy) error
+	FailOrder(ctx context.Context, owner string, failure domain.OrderFailure, maxFailures int) (bool, error)
+	GetDeadLetters(ctx context.Context) ([]domain.DeadLetter, error)
+	RetryDeadLetter(ctx context.Context, orderID string) error
+	DiscardDeadLetter(ctx context.Context, orderID string) error
 }
 
 type ScoringSystem struct {
@@ -21,10 +37,108 @@ func NewScoringSystem(repo ScoringSystemRepository) *ScoringSystem {
 	}
 }
 
-func (s *ScoringSystem) GetOrderStatus(ctx context.Context) ([]string, error) {
-	return s.repo.GetOrderStatus(ctx)
+func (s *ScoringSystem) GetOrderStatus(ctx context.Context, owner string, lease time.Duration, limit int) ([]domain.PendingOrder, error) {
+	return s.repo.GetOrderStatus(ctx, owner, lease, limit)
 }
 
-func (s *ScoringSystem) UpdateOrder(ctx context.Context, order domain.ScoringSystem) error {
-	return s.repo.UpdateOrder(ctx, order)
+// UpdateOrder применяет ответ системы расчёта к заказу с учётом допустимых переходов статусов.
+func (s *ScoringSystem) UpdateOrder(ctx context.Context, owner string, order domain.ScoringSystem, nextCheckAt time.Time) error {
+	status, err := domain.ParseAccrualStatus(order.Status)
+	if err != nil {
+		return err
+	}
+	order.Status = status
+
+	return s.repo.UpdateOrder(ctx, owner, order, nextCheckAt)
+}
+
+// UpdateOrders применяет ответы системы расчёта по нескольким заказам в одной транзакции.
+// Заказы, которые не удалось обновить, возвращаются в rejected с причиной.
+func (s *ScoringSystem) UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error) {
+	rejected := make(map[string]error)
+	valid := make([]domain.OrderUpdate, 0, len(updates))
+	for _, update := range updates {
+		status, err := domain.ParseAccrualStatus(update.Order.Status)
+		if err != nil {
+			rejected[update.Order.OrderID] = err
+			continue
+		}
+		update.Order.Status = status
+		valid = append(valid, update)
+	}
+
+	failed, err := s.repo.UpdateOrders(ctx, owner, valid)
+	if err != nil {
+		return nil, err
+	}
+	for id, err := range failed {
+		rejected[id] = err
+	}
+	return rejected, nil
+}
+
+func (s *ScoringSystem) RescheduleOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	return s.repo.RescheduleOrder(ctx, owner, orderID, nextCheckAt)
+}
+
+func (s *ScoringSystem) PostponeOrder(ctx context.Context, owner string, orderID string, nextCheckAt time.Time) error {
+	return s.repo.PostponeOrder(ctx, owner, orderID, nextCheckAt)
+}
+
+// ExpireOrder прекращает опрос заказа, о котором система расчёта так и не узнала.
+func (s *ScoringSystem) ExpireOrder(ctx context.Context, owner string, orderID string) error {
+	return s.repo.UpdateOrder(ctx, owner, domain.ScoringSystem{OrderID: orderID, Status: domain.Unregistered}, time.Now())
+}
+
+// RequeueOrder возвращает заказ в очередь опроса системы расчёта.
+func (s *ScoringSystem) RequeueOrder(ctx context.Context, orderID string) error {
+	return s.repo.RequeueOrder(ctx, orderID)
+}
+
+func (s *ScoringSystem) GetOrder(ctx context.Context, orderID string) (domain.Order, error) {
+	return s.repo.GetOrder(ctx, orderID)
+}
+
+// BumpOrder ставит заказ в начало очереди опроса системы расчёта.
+func (s *ScoringSystem) BumpOrder(ctx context.Context, orderID string) error {
+	return s.repo.BumpOrder(ctx, orderID)
+}
+
+func (s *ScoringSystem) GetProcessedOrders(ctx context.Context, after string, since time.Time, limit int) ([]domain.Order, error) {
+	return s.repo.GetProcessedOrders(ctx, after, since, limit)
+}
+
+func (s *ScoringSystem) AddDiscrepancy(ctx context.Context, discrepancy domain.Discrepancy) error {
+	return s.repo.AddDiscrepancy(ctx, discrepancy)
+}
+
+func (s *ScoringSystem) ResolveDiscrepancy(ctx context.Context, orderID string) error {
+	return s.repo.ResolveDiscrepancy(ctx, orderID)
+}
+
+// CorrectOrder исправляет заказ по окончательному расчёту, найденному сверкой.
+func (s *ScoringSystem) CorrectOrder(ctx context.Context, discrepancy domain.Discrepancy) error {
+	if !discrepancy.Correctable() {
+		return fmt.Errorf("%w: %s -> %s", domain.ErrStatusTransition, discrepancy.StoredStatus, discrepancy.RemoteStatus)
+	}
+	return s.repo.CorrectOrder(ctx, discrepancy)
+}
+
+// FailOrder засчитывает заказу сбой обработки ответа и сообщает, переведён ли заказ в accrual_dead_letters.
+func (s *ScoringSystem) FailOrder(ctx context.Context, owner string, failure domain.OrderFailure, maxFailures int) (bool, error) {
+	return s.repo.FailOrder(ctx, owner, failure, maxFailures)
+}
+
+func (s *ScoringSystem) GetDeadLetters(ctx context.Context) ([]domain.DeadLetter, error) {
+	return s.repo.GetDeadLetters(ctx)
+}
+
+// RetryDeadLetter возвращает заказ из accrual_dead_letters в очередь опроса.
+func (s *ScoringSystem) RetryDeadLetter(ctx context.Context, orderID string) error {
+	return s.repo.RetryDeadLetter(ctx, orderID)
+}
+
+// DiscardDeadLetter закрывает заказ в accrual_dead_letters без повторного опроса.
+func (s *ScoringSystem) DiscardDeadLetter(ctx context.Context, orderID string) error {
+	return s.repo.DiscardDeadLetter(ctx, orderID)
 }
@@ -0,0 +1,266 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// @Summary RequeueOrder
+// @Description Возвращает заказ в статусе UNREGISTERED в очередь опроса системы расчёта.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID requeue order
+// @Param number path string true "order ID"
+// @Success 202 "Status Accepted"
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 409 "Conflict"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/orders/{number}/requeue [post]
+func (s *APIServer) RequeueOrder(w http.ResponseWriter, r *http.Request) {
+	if err := s.scoringsystem.RequeueOrder(r.Context(), chi.URLParam(r, "number")); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrOrderNotFound):
+			logError("requeueOrder", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case errors.Is(err, domain.ErrStatusTransition):
+			logError("requeueOrder", err)
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			logError("requeueOrder", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary BumpOrder
+// @Description Ставит необработанный заказ в начало очереди опроса системы расчёта и назначает проверку на ближайший раунд.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID bump order
+// @Param number path string true "order ID"
+// @Success 202 "Status Accepted"
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 409 "Conflict"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/orders/{number}/bump [post]
+func (s *APIServer) BumpOrder(w http.ResponseWriter, r *http.Request) {
+	if err := s.scoringsystem.BumpOrder(r.Context(), chi.URLParam(r, "number")); err != nil {
+		logError("bumpOrder", err)
+		switch {
+		case errors.Is(err, domain.ErrOrderNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, domain.ErrOrderFinished):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary RecheckOrder
+// @Description Синхронно запрашивает расчёт по заказу в системе расчёта, применяет его по правилам переходов статусов и возвращает исходный ответ системы расчёта вместе с сохранённым заказом.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID recheck order
+// @Produce json
+// @Param number path string true "order ID"
+// @Success 200 {object} domain.RecheckResult
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 422 "Unprocessable Entity"
+// @Failure 500 "Internal Server Error"
+// @Failure 502 "Bad Gateway"
+// @Failure 503 "Service Unavailable"
+// @Router /api/admin/orders/{number}/recheck [post]
+func (s *APIServer) RecheckOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "number")
+	if _, err := s.scoringsystem.GetOrder(r.Context(), orderID); err != nil {
+		logError("recheckOrder", err)
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.AccrualRequestTimeout)
+	defer cancel()
+
+	var result domain.RecheckResult
+	remote, provider, err := s.providers.Check(ctx, orderID)
+	result.Provider = provider
+
+	var (
+		payloadErr *accrual.PayloadError
+		rateErr    *accrual.RateLimitError
+	)
+	switch {
+	case err == nil:
+		result.Response = remote.Payload
+		rejected, err := s.scoringsystem.UpdateOrders(r.Context(), "", []domain.OrderUpdate{{Order: *remote, NextCheckAt: time.Now()}})
+		if err != nil {
+			logError("recheckOrder", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := rejected[orderID]; err != nil && !errors.Is(err, domain.ErrOrderUnchanged) {
+			result.Error = err.Error()
+		}
+	case errors.Is(err, accrual.ErrNotRegistered):
+		result.Error = err.Error()
+	case errors.As(err, &payloadErr):
+		result.Response = payloadErr.Payload
+		result.Error = err.Error()
+	case errors.Is(err, accrual.ErrNoProvider):
+		logError("recheckOrder", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, accrual.ErrCircuitOpen), errors.As(err, &rateErr), errors.Is(err, context.DeadlineExceeded):
+		logError("recheckOrder", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	default:
+		logError("recheckOrder", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	result.Order, err = s.scoringsystem.GetOrder(r.Context(), orderID)
+	if err != nil {
+		logError("recheckOrder", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		logError("recheckOrder", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultJSON)
+}
+
+// @Summary GetDeadLetters
+// @Description Выводит заказы, исключённые из опроса системы расчёта после повторяющихся сбоев обработки, с последней ошибкой и исходным ответом.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID get dead letters
+// @Produce json
+// @Success 200 {array} domain.DeadLetter
+// @Failure 204 "Status No Content"
+// @Failure 401 "Status Unauthorized"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/dead-letters [get]
+func (s *APIServer) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := s.scoringsystem.GetDeadLetters(r.Context())
+	if err != nil {
+		if errors.Is(err, domain.ErrNoData) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		logError("getDeadLetters", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	lettersJSON, err := json.Marshal(letters)
+	if err != nil {
+		logError("getDeadLetters", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(lettersJSON)
+}
+
+// @Summary RetryDeadLetter
+// @Description Сбрасывает счётчики сбоев и проверок заказа и возвращает его в очередь опроса системы расчёта.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID retry dead letter
+// @Param number path string true "order ID"
+// @Success 202 "Status Accepted"
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/dead-letters/{number}/retry [post]
+func (s *APIServer) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if err := s.scoringsystem.RetryDeadLetter(r.Context(), chi.URLParam(r, "number")); err != nil {
+		logError("retryDeadLetter", err)
+		if errors.Is(err, domain.ErrDeadLetterNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary DiscardDeadLetter
+// @Description Убирает заказ из списка сбойных. Заказ остаётся в текущем статусе и не опрашивается, пока его не вернут в очередь через retry.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID discard dead letter
+// @Param number path string true "order ID"
+// @Success 200 "OK"
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/dead-letters/{number}/discard [post]
+func (s *APIServer) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if err := s.scoringsystem.DiscardDeadLetter(r.Context(), chi.URLParam(r, "number")); err != nil {
+		logError("discardDeadLetter", err)
+		if errors.Is(err, domain.ErrDeadLetterNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary ReverseWithdraw
+// @Description Отменяет списание баллов по номеру заказа и возвращает баллы пользователю. Возврат записывается в журнал баллов со ссылкой на списание.
+// @Security AdminKeyAuth
+// @Tags admin
+// @ID reverse withdraw
+// @Produce json
+// @Param number path string true "order ID"
+// @Success 200 {object} domain.Withdraw
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 409 "Conflict"
+// @Failure 422 "Status Unprocessable Entity"
+// @Failure 500 "Internal Server Error"
+// @Router /api/admin/withdrawals/{number}/reverse [post]
+func (s *APIServer) ReverseWithdraw(w http.ResponseWriter, r *http.Request) {
+	s.reverseWithdraw(w, r, "reverseWithdraw", chi.URLParam(r, "number"))
+}
@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/accrual/accrualtest"
+	"github.com/amiosamu/gofemart/internal/config"
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/httpclient"
+	"github.com/amiosamu/gofemart/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+)
+
+// recheckRepository хранит статусы заказов в памяти и применяет к ним обновления без проверки переходов.
+// Заказы из reject отклоняются с указанной ошибкой.
+type recheckRepository struct {
+	service.ScoringSystemRepository
+	orders map[string]domain.Order
+	reject map[string]error
+}
+
+func (r *recheckRepository) GetOrder(ctx context.Context, orderID string) (domain.Order, error) {
+	order, ok := r.orders[orderID]
+	if !ok {
+		return domain.Order{}, domain.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (r *recheckRepository) UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error) {
+	rejected := make(map[string]error)
+	for _, update := range updates {
+		if err := r.reject[update.Order.OrderID]; err != nil {
+			rejected[update.Order.OrderID] = err
+			continue
+		}
+		order := r.orders[update.Order.OrderID]
+		order.Status = update.Order.Status
+		order.Bonuses = domain.NewAmount(update.Order.Bonuses)
+		r.orders[update.Order.OrderID] = order
+	}
+	return rejected, nil
+}
+
+func newRecheckServer(t *testing.T, accrualServer *accrualtest.Server, repo *recheckRepository) http.Handler {
+	t.Helper()
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	var providers *accrual.Registry
+	if accrualServer != nil {
+		client := accrual.NewHTTPClient(accrualServer.URL, httpclient.New(httpclient.Config{
+			RequestTimeout: 5 * time.Second,
+			MaxBodySize:    1 << 20,
+		}))
+		providers = accrual.NewRegistry(accrual.NewProvider(accrual.ProviderConfig{
+			Name:             "primary",
+			BreakerThreshold: 1,
+			BreakerCooldown:  time.Hour,
+		}, client, logger))
+	} else {
+		providers = accrual.NewRegistry()
+	}
+
+	s := &APIServer{
+		config:        &config.Config{AccrualRequestTimeout: 5 * time.Second},
+		scoringsystem: service.NewScoringSystem(repo),
+		providers:     providers,
+	}
+	router := chi.NewRouter()
+	router.Post("/orders/{number}/recheck", s.RecheckOrder)
+	return router
+}
+
+func recheck(t *testing.T, handler http.Handler, orderID string) (int, domain.RecheckResult) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%s/recheck", orderID), nil))
+
+	var result domain.RecheckResult
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, result
+}
+
+func newOrders(orderIDs ...string) map[string]domain.Order {
+	orders := make(map[string]domain.Order, len(orderIDs))
+	for _, orderID := range orderIDs {
+		orders[orderID] = domain.Order{OrderID: orderID, Status: domain.NewOrder}
+	}
+	return orders
+}
+
+func TestRecheckOrderApplies(t *testing.T) {
+	accrualServer := accrualtest.NewServer()
+	defer accrualServer.Close()
+	accrualServer.Script("100", accrualtest.Processed(decimal.NewFromInt(500)))
+	accrualServer.Script("200", accrualtest.Processed(decimal.NewFromInt(500)))
+
+	repo := &recheckRepository{
+		orders: newOrders("100", "200"),
+		reject: map[string]error{"200": fmt.Errorf("%w: INVALID -> PROCESSED", domain.ErrStatusTransition)},
+	}
+	handler := newRecheckServer(t, accrualServer, repo)
+
+	code, result := recheck(t, handler, "100")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if result.Provider != "primary" || result.Error != "" || len(result.Response) == 0 {
+		t.Errorf("result = %+v, want applied response from primary", result)
+	}
+	if result.Order.Status != domain.Processed || !result.Order.Bonuses.Equal(decimal.NewFromInt(500)) {
+		t.Errorf("order = %+v, want PROCESSED with 500", result.Order)
+	}
+
+	// Запрещённый переход не ошибка запроса: администратор видит ответ системы расчёта и причину.
+	code, result = recheck(t, handler, "200")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if result.Error == "" || len(result.Response) == 0 || result.Order.Status != domain.NewOrder {
+		t.Errorf("result = %+v, want the rejected transition reported and the order unchanged", result)
+	}
+}
+
+func TestRecheckOrderNotRegistered(t *testing.T) {
+	accrualServer := accrualtest.NewServer()
+	defer accrualServer.Close()
+
+	handler := newRecheckServer(t, accrualServer, &recheckRepository{orders: newOrders("100")})
+	code, result := recheck(t, handler, "100")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if result.Error == "" || len(result.Response) != 0 || result.Order.Status != domain.NewOrder {
+		t.Errorf("result = %+v, want not registered error and unchanged order", result)
+	}
+}
+
+func TestRecheckOrderErrors(t *testing.T) {
+	accrualServer := accrualtest.NewServer()
+	defer accrualServer.Close()
+	accrualServer.Default(accrualtest.InternalError())
+
+	handler := newRecheckServer(t, accrualServer, &recheckRepository{orders: newOrders("100")})
+	if code, _ := recheck(t, handler, "999"); code != http.StatusNotFound {
+		t.Errorf("unknown order status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := recheck(t, handler, "100"); code != http.StatusBadGateway {
+		t.Errorf("accrual system error status = %d, want %d", code, http.StatusBadGateway)
+	}
+	// Автомат провайдера разомкнулся после первого сбоя.
+	if code, _ := recheck(t, handler, "100"); code != http.StatusServiceUnavailable {
+		t.Errorf("open circuit status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	noProviders := newRecheckServer(t, nil, &recheckRepository{orders: newOrders("100")})
+	if code, _ := recheck(t, noProviders, "100"); code != http.StatusUnprocessableEntity {
+		t.Errorf("no provider status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
 )
 
 // @Summary Balance
@@ -51,6 +52,7 @@ func (s *APIServer) Balance(w http.ResponseWriter, r *http.Request) {
 // @Failure 402 "Status Payment Required"
 // @Failure 422 "Status Unprocessable Entity"
 // @Failure 500 "Internal Server Error"
+// @Failure 503 "Service Unavailable"
 // @Router /api/user/balance/withdraw [post]
 func (s *APIServer) Withdraw(w http.ResponseWriter, r *http.Request) {
 	data, err := io.ReadAll(r.Body)
@@ -76,7 +78,7 @@ func (s *APIServer) Withdraw(w http.ResponseWriter, r *http.Request) {
 			logError("withdraw", err)
 			w.WriteHeader(http.StatusConflict)
 			return
-		} else if errors.Is(err, domain.ErrIncorrectOrder) {
+		} else if errors.Is(err, domain.ErrIncorrectOrder) || errors.Is(err, domain.ErrIncorrectSum) {
 			logError("withdraw", err)
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
@@ -84,6 +86,12 @@ func (s *APIServer) Withdraw(w http.ResponseWriter, r *http.Request) {
 			logError("withdraw", err)
 			w.WriteHeader(http.StatusPaymentRequired)
 			return
+		} else if errors.Is(err, domain.ErrBalanceLocked) {
+			// Баланс не удалось заблокировать вовремя, списание откатилось и его можно безопасно повторить.
+			logError("withdraw", err)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
 		}
 		logError("withdraw", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -125,3 +133,69 @@ func (s *APIServer) Withdrawals(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(withdrawalsJSON)
 }
+
+// @Summary MerchantReverseWithdraw
+// @Description Отменяет списание баллов по заказу, отменённому в магазине, и возвращает баллы пользователю. Запрос подписывается HMAC-SHA256 с общим секретом от строки "<X-Timestamp>.<тело запроса>"; подписи старше 5 минут отклоняются. Секрет общий для всех магазинов, а списание не связано с магазином, поэтому отмена не ограничена списаниями магазина, подписавшего запрос: любой владелец секрета может отменить любое списание.
+// @Tags withdraw
+// @ID merchant reverse withdraw
+// @Accept json
+// @Produce json
+// @Param X-Timestamp header integer true "время подписи в секундах Unix"
+// @Param X-Signature header string true "hex HMAC-SHA256 от \"<X-Timestamp>.<тело запроса>\""
+// @Param input body domain.WithdrawReversal true "номер заказа списания"
+// @Success 200 {object} domain.Withdraw
+// @Failure 400 "Bad Request"
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 409 "Conflict"
+// @Failure 413 "Request Entity Too Large"
+// @Failure 422 "Status Unprocessable Entity"
+// @Failure 500 "Internal Server Error"
+// @Router /api/merchant/withdrawals/reverse [post]
+func (s *APIServer) MerchantReverseWithdraw(w http.ResponseWriter, r *http.Request) {
+	var reversal domain.WithdrawReversal
+	if err := json.NewDecoder(r.Body).Decode(&reversal); err != nil {
+		logError("merchantReverseWithdraw", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.reverseWithdraw(w, r, "merchantReverseWithdraw", reversal.OrderID)
+}
+
+// reverseWithdraw отменяет списание и отвечает отменённым списанием.
+func (s *APIServer) reverseWithdraw(w http.ResponseWriter, r *http.Request, op string, orderID string) {
+	withdraw, err := s.withdraw.ReverseWithdraw(r.Context(), orderID)
+	if err != nil {
+		logError(op, err)
+		switch {
+		case errors.Is(err, domain.ErrIncorrectOrder):
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case errors.Is(err, domain.ErrWithdrawNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, domain.ErrWithdrawReversed):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.logger.WithFields(log.Fields{
+		"order":  withdraw.OrderID,
+		"user":   withdraw.UserID,
+		"sum":    withdraw.Bonuses.String(),
+		"source": op,
+	}).Info("withdraw reversed")
+
+	withdrawJSON, err := json.Marshal(withdraw)
+	if err != nil {
+		logError(op, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(withdrawJSON)
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/scheduler"
+)
+
+// Health — состояние сервиса и его связи с системами расчёта.
+type Health struct {
+	Status  string                   `json:"status"`
+	Accrual []accrual.ProviderStatus `json:"accrual"`
+	// Leaders — задачи-одиночки и признак того, что их выполняет этот экземпляр.
+	Leaders map[string]bool       `json:"leaders,omitempty"`
+	Jobs    []scheduler.JobStatus `json:"jobs"`
+}
+
+// @Summary Health
+// @Description Выводит состояние сервиса, автоматов защиты обращений к каждой системе расчёта и фоновых задач и лидерства в задачах-одиночках. Статус degraded означает, что хотя бы одна система расчёта недоступна.
+// @Tags health
+// @ID health
+// @Produce json
+// @Success 200 {object} transport.Health
+// @Failure 500 "Internal Server Error"
+// @Router /api/health [get]
+func (s *APIServer) Health(w http.ResponseWriter, r *http.Request) {
+	health := Health{
+		Status:  "ok",
+		Accrual: s.providers.Status(),
+		Leaders: s.elector.Status(),
+		Jobs:    s.scheduler.Status(),
+	}
+	for _, provider := range health.Accrual {
+		if provider.Breaker.State != accrual.BreakerClosed {
+			health.Status = "degraded"
+		}
+	}
+
+	healthJSON, err := json.Marshal(health)
+	if err != nil {
+		logError("health", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(healthJSON)
+}
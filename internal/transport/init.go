@@ -1,13 +1,20 @@
 package transport
 
 import (
+	"context"
+	"expvar"
+	"fmt"
 	"net/http"
 	"time"
 
 	_ "github.com/amiosamu/gofemart/docs"
+	"github.com/amiosamu/gofemart/internal/accrual"
 	"github.com/amiosamu/gofemart/internal/config"
 	"github.com/amiosamu/gofemart/internal/hash"
+	"github.com/amiosamu/gofemart/internal/httpclient"
+	"github.com/amiosamu/gofemart/internal/leader"
 	"github.com/amiosamu/gofemart/internal/repository"
+	"github.com/amiosamu/gofemart/internal/scheduler"
 	"github.com/amiosamu/gofemart/internal/service"
 	"github.com/go-chi/chi/v5"
 	log "github.com/sirupsen/logrus"
@@ -23,6 +30,13 @@ type APIServer struct {
 	orders        *service.Orders
 	withdraw      *service.Bonuses
 	scoringsystem *service.ScoringSystem
+	accrual       *accrual.Poller
+	reconciler    *accrual.Reconciler
+	providers     *accrual.Registry
+	// elector выбирает экземпляр, который выполняет задачи-одиночки.
+	elector *leader.Elector
+	// scheduler запускает все фоновые задачи, в том числе опрос системы расчёта.
+	scheduler *scheduler.Scheduler
 }
 
 func NewAPIServer(config *config.Config) *APIServer {
@@ -33,8 +47,14 @@ func NewAPIServer(config *config.Config) *APIServer {
 	}
 }
 
-func (s *APIServer) Start() error {
+// Start запускает HTTP-сервер и фоновые задачи. При отмене ctx перестаёт принимать
+// новые запросы, дожидается завершения текущих запросов и задач, затем закрывает хранилище,
+// но не дольше config.ShutdownTimeout.
+func (s *APIServer) Start(ctx context.Context) error {
 	s.config.ParseFlags()
+	if err := s.config.LoadSecrets(); err != nil {
+		return err
+	}
 	s.configureRouter()
 
 	if err := s.configureLogger(); err != nil {
@@ -53,23 +73,161 @@ func (s *APIServer) Start() error {
 	s.orders = service.NewOrders(db)
 	s.withdraw = service.NewBonuses(db, db)
 	s.scoringsystem = service.NewScoringSystem(db)
+	s.elector = leader.NewElector(db.DB, leader.Config{Renew: s.config.LeaderRenewInterval}, s.logger)
+
+	httpClient := httpclient.New(httpclient.Config{
+		RequestTimeout:      s.config.AccrualRequestTimeout,
+		DialTimeout:         s.config.AccrualDialTimeout,
+		KeepAlive:           s.config.AccrualKeepAlive,
+		IdleConnTimeout:     s.config.AccrualIdleConnTimeout,
+		MaxIdleConns:        s.config.AccrualMaxIdleConns,
+		MaxIdleConnsPerHost: s.config.AccrualMaxIdleConns,
+		MaxConnsPerHost:     s.config.AccrualMaxConns,
+		MaxBodySize:         s.config.AccrualMaxBodySize,
+	})
+	defer httpClient.CloseIdleConnections()
+	providers, err := s.configureProviders(httpClient)
+	if err != nil {
+		return err
+	}
+	s.providers = providers
+	s.accrual = accrual.NewPoller(accrual.Config{
+		Workers:   s.config.AccrualWorkers,
+		Owner:     s.config.InstanceID,
+		Lease:     s.config.AccrualLease,
+		BatchSize: s.config.AccrualBatchSize,
+		Policy: accrual.Policy{
+			Backoff: accrual.Backoff{
+				Base: s.config.AccrualBackoffBase,
+				Max:  s.config.AccrualBackoffMax,
+			},
+			FreshAge:   s.config.AccrualFreshAge,
+			AgedFactor: s.config.AccrualAgedFactor,
+		},
+		MaxAttempts: s.config.AccrualMaxAttempts,
+		MaxAge:      s.config.AccrualMaxAge,
+		MaxFailures: s.config.AccrualMaxFailures,
+	}, s.providers, s.scoringsystem, s.logger)
+	s.reconciler = accrual.NewReconciler(accrual.ReconcileConfig{
+		Window:      s.config.AccrualReconcileWindow,
+		AutoCorrect: s.config.AccrualReconcileFix,
+	}, s.providers, s.scoringsystem, s.logger)
+
+	if s.config.Reconcile {
+		return s.reconcile(ctx)
+	}
+	if s.config.RepairBalances {
+		return s.repairBalances(ctx)
+	}
 
-	s.logger.Info("starting api server")
+	s.scheduler = scheduler.New(s.elector, s.logger)
+	if err := s.configureJobs(); err != nil {
+		return err
+	}
+	go s.scheduler.Run(ctx)
 
-	ticker := time.NewTicker(time.Millisecond * 100)
+	server := &http.Server{
+		Addr:    s.config.Port,
+		Handler: s.router,
+	}
+
+	serverErr := make(chan error, 1)
 	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				s.ScoringSystem()
-			default:
-				continue
-			}
+		s.logger.Info("starting api server")
+		serverErr <- server.ListenAndServe()
+	}()
 
-		}
+	select {
+	case err := <-serverErr:
+		s.stopScheduler(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down api server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithFields(log.Fields{"stage": "shutdown"}).Error(err)
+	}
+	s.stopScheduler(shutdownCtx)
+	return nil
+}
+
+// stopScheduler останавливает фоновые задачи и ждёт идущие запуски, пока не истечёт ctx.
+func (s *APIServer) stopScheduler(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.scheduler.Stop()
+		close(stopped)
 	}()
 
-	return http.ListenAndServe(s.config.Port, s.router)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.logger.WithFields(log.Fields{"stage": "shutdown"}).Warn("background jobs did not stop in time")
+	}
+}
+
+// configureJobs регистрирует фоновые задачи в планировщике.
+func (s *APIServer) configureJobs() error {
+	if s.config.AccrualPolling {
+		// Раунд опроса не должен пережить аренду заказов, иначе их заберёт другой экземпляр.
+		err := s.scheduler.Add(scheduler.Job{
+			Name:     "accrual-poll",
+			Schedule: scheduler.Every(s.config.AccrualPollInterval),
+			Timeout:  s.config.AccrualLease,
+			Run:      s.accrual.Poll,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.config.AccrualReconcileSchedule != "" {
+		schedule, err := scheduler.Parse(s.config.AccrualReconcileSchedule)
+		if err != nil {
+			return err
+		}
+		err = s.scheduler.Add(scheduler.Job{
+			Name:      "accrual-reconcile",
+			Schedule:  schedule,
+			Jitter:    time.Minute,
+			Singleton: true,
+			Run:       s.reconcile,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcile сверяет обработанные заказы с системами расчёта и выводит итог в лог.
+func (s *APIServer) reconcile(ctx context.Context) error {
+	report, err := s.reconciler.Run(ctx)
+	s.logger.WithFields(log.Fields{
+		"worker":        "reconcile",
+		"checked":       report.Checked,
+		"discrepancies": report.Discrepancies,
+		"corrected":     report.Corrected,
+		"skipped":       report.Skipped,
+	}).Info("accrual reconciliation finished")
+	return err
+}
+
+// repairBalances пересчитывает балансы пользователей по журналу баллов и выводит итог в лог.
+func (s *APIServer) repairBalances(ctx context.Context) error {
+	repaired, err := s.withdraw.RepairBalances(ctx)
+	if err != nil {
+		return err
+	}
+	s.logger.WithFields(log.Fields{
+		"worker":   "balances",
+		"repaired": repaired,
+	}).Info("balances repaired")
+	return nil
 }
 
 func (s *APIServer) configureRouter() {
@@ -78,9 +236,31 @@ func (s *APIServer) configureRouter() {
 	s.router.Post("/api/user/login", s.SighIn)
 	s.router.With(s.authMiddleware).Post("/api/user/orders", s.OrderUploading)
 	s.router.With(s.authMiddleware).Get("/api/user/orders", s.GetAllOrders)
+	s.router.With(s.authMiddleware).Get("/api/user/orders/{number}/history", s.GetOrderHistory)
 	s.router.With(s.authMiddleware).Get("/api/user/balance", s.Balance)
 	s.router.With(s.authMiddleware).Post("/api/user/balance/withdraw", s.Withdraw)
 	s.router.With(s.authMiddleware).Get("/api/user/withdrawals", s.Withdrawals)
+	if s.config.AccrualCallbackSecret != "" {
+		s.router.With(signatureMiddleware([]byte(s.config.AccrualCallbackSecret))).Post("/internal/accrual/callback", s.AccrualCallback)
+	}
+	if s.config.AdminToken != "" {
+		s.router.Route("/api/admin", func(r chi.Router) {
+			r.Use(s.adminMiddleware)
+			r.Post("/orders/{number}/requeue", s.RequeueOrder)
+			r.Post("/orders/{number}/bump", s.BumpOrder)
+			r.Post("/orders/{number}/recheck", s.RecheckOrder)
+			r.Get("/dead-letters", s.GetDeadLetters)
+			r.Post("/dead-letters/{number}/retry", s.RetryDeadLetter)
+			r.Post("/dead-letters/{number}/discard", s.DiscardDeadLetter)
+			r.Post("/withdrawals/{number}/reverse", s.ReverseWithdraw)
+		})
+		// expvar публикует аргументы командной строки и статистику памяти, поэтому метрики только для администратора.
+		s.router.With(s.adminMiddleware).Handle("/debug/vars", expvar.Handler())
+	}
+	if s.config.MerchantSecret != "" {
+		s.router.With(signatureMiddleware([]byte(s.config.MerchantSecret))).Post("/api/merchant/withdrawals/reverse", s.MerchantReverseWithdraw)
+	}
+	s.router.Get("/api/health", s.Health)
 	s.router.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
 	))
@@ -95,6 +275,37 @@ func (s *APIServer) configureLogger() error {
 	return nil
 }
 
+// configureProviders собирает реестр систем расчёта из config.AccrualProviders.
+// Все провайдеры используют общий пул соединений httpClient.
+func (s *APIServer) configureProviders(httpClient *httpclient.Client) (*accrual.Registry, error) {
+	configs, err := s.config.AccrualProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]*accrual.Provider, 0, len(configs))
+	for _, cfg := range configs {
+		rule, err := accrual.NewRule(cfg.Prefix, cfg.Length, cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("accrual provider %q: %w", cfg.Name, err)
+		}
+
+		var client accrual.Client
+		if cfg.URL != "" {
+			client = accrual.NewHTTPClient(cfg.URL, httpClient)
+		}
+		providers = append(providers, accrual.NewProvider(accrual.ProviderConfig{
+			Name:             cfg.Name,
+			Rule:             rule,
+			Callback:         cfg.Callback,
+			RateLimit:        cfg.RateLimit,
+			BreakerThreshold: s.config.AccrualBreakerThreshold,
+			BreakerCooldown:  s.config.AccrualBreakerCooldown,
+		}, client, s.logger))
+	}
+	return accrual.NewRegistry(providers...), nil
+}
+
 func (s *APIServer) configureStore() (*repository.Storage, error) {
 	db, err := repository.NewStorage(s.config.DBPort)
 	if err != nil {
@@ -1,8 +1,17 @@
 package transport
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
@@ -101,3 +110,83 @@ func getTokenFromRequest(r *http.Request) (string, error) {
 	}
 	return token.Value, nil
 }
+
+// maxSignedBodySize ограничивает тело подписанного запроса, которое читается до проверки подписи.
+const maxSignedBodySize = 1 << 20
+
+// maxSignatureAge — насколько время подписи может расходиться с часами сервиса. Подписанный запрос
+// старше этого нельзя повторить.
+const maxSignatureAge = 5 * time.Minute
+
+// signatureMiddleware пропускает только запросы, подписанные HMAC-SHA256 с секретом secret.
+// Подписывается строка "<X-Timestamp>.<тело запроса>", где X-Timestamp — время подписи в секундах Unix,
+// подпись передаётся в заголовке X-Signature в hex. Запросы с временем подписи, отличающимся
+// от текущего больше чем на maxSignatureAge, отклоняются, чтобы перехваченный запрос нельзя было повторить позже.
+func signatureMiddleware(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+			if err != nil {
+				logError("signatureMiddleware", err)
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			timestamp := r.Header.Get("X-Timestamp")
+			signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				logError("signatureMiddleware", errors.New("missing or malformed timestamp"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if age := time.Since(time.Unix(signedAt, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+				logError("signatureMiddleware", fmt.Errorf("stale signature: signed %s ago", age))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			signature, err := hex.DecodeString(r.Header.Get("X-Signature"))
+			if err != nil || len(signature) == 0 {
+				logError("signatureMiddleware", errors.New("missing or malformed signature"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if !hmac.Equal(signature, sign(secret, timestamp, data)) {
+				logError("signatureMiddleware", errors.New("invalid signature"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewBuffer(data))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sign возвращает HMAC-SHA256 от "<timestamp>.<body>".
+func sign(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// adminMiddleware пропускает только запросы с токеном администратора в заголовке X-Admin-Token.
+func (s *APIServer) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			logError("adminMiddleware", errors.New("invalid admin token"))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureMiddleware(t *testing.T) {
+	secret := []byte("callback secret")
+	body := `[{"order":"12345678903","status":"PROCESSED","accrual":500}]`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-maxSignatureAge-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(maxSignatureAge+time.Minute).Unix(), 10)
+	signature := func(timestamp string) string {
+		return hex.EncodeToString(sign(secret, timestamp, []byte(body)))
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      string
+		want      int
+	}{
+		{"valid", now, signature(now), body, http.StatusOK},
+		{"missing signature", now, "", body, http.StatusUnauthorized},
+		{"malformed signature", now, "not hex", body, http.StatusUnauthorized},
+		{"wrong secret", now, hex.EncodeToString(sign([]byte("other"), now, []byte(body))), body, http.StatusUnauthorized},
+		{"tampered body", now, signature(now), strings.Replace(body, "500", "5000", 1), http.StatusUnauthorized},
+		{"body signed without timestamp", now, hex.EncodeToString(sign(secret, "", []byte(body))), body, http.StatusUnauthorized},
+		{"missing timestamp", "", signature(""), body, http.StatusUnauthorized},
+		{"timestamp does not match signature", now, signature(stale), body, http.StatusUnauthorized},
+		{"stale", stale, signature(stale), body, http.StatusUnauthorized},
+		{"from the future", future, signature(future), body, http.StatusUnauthorized},
+		{"too large", now, signature(now), strings.Repeat("x", maxSignedBodySize+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			handler := signatureMiddleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/internal/accrual/callback", strings.NewReader(tt.body))
+			if tt.timestamp != "" {
+				req.Header.Set("X-Timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				req.Header.Set("X-Signature", tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && received != tt.body {
+				t.Errorf("handler received body %q, want %q", received, tt.body)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/go-chi/chi/v5"
 )
 
 // @Summary OrderUploading
@@ -91,3 +92,40 @@ func (s *APIServer) GetAllOrders(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(ordersJSON)
 }
+
+// @Summary GetOrderHistory
+// @Description Выводит историю изменения статусов заказа пользователя с исходными ответами системы расчёта.
+// @Security ApiKeyAuth
+// @Tags orders
+// @ID get order history
+// @Produce json
+// @Param number path string true "order ID"
+// @Success 200 {array} domain.OrderStatusChange
+// @Failure 401 "Status Unauthorized"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Server Error"
+// @Router /api/user/orders/{number}/history [get]
+func (s *APIServer) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := s.orders.GetOrderHistory(r.Context(), chi.URLParam(r, "number"))
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			logError("getOrderHistory", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logError("getOrderHistory", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		logError("getOrderHistory", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(historyJSON)
+}
@@ -1,51 +1,104 @@
 package transport
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/amiosamu/gofemart/internal/domain"
+	log "github.com/sirupsen/logrus"
 )
 
-func (s *APIServer) ScoringSystem() {
-	orderID, err := s.scoringsystem.GetOrderStatus(context.Background())
+// @Summary AccrualCallback
+// @Description Принимает статусы расчёта начислений сразу по нескольким заказам от системы расчёта и применяет их одной транзакцией. Если заказ встречается в запросе несколько раз, применяется последний статус. Запрос подписывается HMAC-SHA256 с общим секретом от строки "<X-Timestamp>.<тело запроса>"; подписи старше 5 минут отклоняются.
+// @Tags accrual
+// @ID accrual callback
+// @Accept json
+// @Produce json
+// @Param X-Timestamp header integer true "время подписи в секундах Unix"
+// @Param X-Signature header string true "hex HMAC-SHA256 от \"<X-Timestamp>.<тело запроса>\""
+// @Param input body []domain.ScoringSystem true "статусы заказов"
+// @Success 200 {object} domain.CallbackResult
+// @Failure 400 "Bad Request"
+// @Failure 401 "Status Unauthorized"
+// @Failure 413 "Request Entity Too Large"
+// @Failure 500 "Internal Server Error"
+// @Router /internal/accrual/callback [post]
+func (s *APIServer) AccrualCallback(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		logError("scoringSystem", err)
+		logError("accrualCallback", err)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	for _, id := range orderID {
+	var payloads []json.RawMessage
+	if err := json.Unmarshal(data, &payloads); err != nil {
+		logError("accrualCallback", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-		addr := fmt.Sprintf("%s/api/orders/%s", s.config.ScoringSystemPort, id)
-		resp, err := http.Get(addr)
-		if err != nil {
-			logError("scoringSystem", err)
+	// Повторы заказа в одном запросе схлопываются в последний, чтобы заказ применялся и учитывался один раз.
+	updates := make([]domain.OrderUpdate, 0, len(payloads))
+	positions := make(map[string]int, len(payloads))
+	for _, payload := range payloads {
+		var update domain.OrderUpdate
+		if err := json.Unmarshal(payload, &update.Order); err != nil {
+			logError("accrualCallback", err)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusOK {
-
-			data, err := io.ReadAll(resp.Body)
-			if err != nil {
-				logError("scoringSystem", err)
-				return
-			}
-
-			var orderScoring domain.ScoringSystem
-			if err := json.Unmarshal(data, &orderScoring); err != nil {
-				logError("scoringSystem", err)
-				return
-			}
-
-			if err := s.scoringsystem.UpdateOrder(context.Background(), orderScoring); err != nil {
-				logError("scoringSystem", err)
-				return
-			}
+		update.Order.Payload = payload
+		update.NextCheckAt = time.Now()
+		if provider := s.providers.Match(update.Order.OrderID); provider != nil {
+			update.Order.Provider = provider.Name()
 		}
+
+		if i, ok := positions[update.Order.OrderID]; ok {
+			updates[i] = update
+			continue
+		}
+		positions[update.Order.OrderID] = len(updates)
+		updates = append(updates, update)
+	}
+
+	rejected, err := s.scoringsystem.UpdateOrders(r.Context(), "", updates)
+	if err != nil {
+		logError("accrualCallback", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var result domain.CallbackResult
+	for _, update := range updates {
+		// Повторная доставка уже применённого статуса считается применённой,
+		// чтобы система расчёта, повторившая запрос после таймаута, не видела сбоя.
+		err, ok := rejected[update.Order.OrderID]
+		if !ok || errors.Is(err, domain.ErrOrderUnchanged) {
+			result.Applied++
+			continue
+		}
+
+		fields := log.Fields{"handler": "accrualCallback", "order": update.Order.OrderID}
+		if errors.Is(err, domain.ErrStatusTransition) {
+			log.WithFields(fields).Warn(err)
+		} else {
+			log.WithFields(fields).Error(err)
+		}
+		result.Failed = append(result.Failed, update.Order.OrderID)
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		logError("accrualCallback", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultJSON)
 }
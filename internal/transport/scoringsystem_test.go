@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amiosamu/gofemart/internal/accrual"
+	"github.com/amiosamu/gofemart/internal/domain"
+	"github.com/amiosamu/gofemart/internal/service"
+)
+
+// callbackRepository записывает обновления, переданные в хранилище; остальные методы не используются.
+type callbackRepository struct {
+	service.ScoringSystemRepository
+	updates []domain.OrderUpdate
+}
+
+func (r *callbackRepository) UpdateOrders(ctx context.Context, owner string, updates []domain.OrderUpdate) (map[string]error, error) {
+	r.updates = append(r.updates, updates...)
+	return nil, nil
+}
+
+func TestAccrualCallbackDeduplicatesOrders(t *testing.T) {
+	repo := &callbackRepository{}
+	s := &APIServer{
+		scoringsystem: service.NewScoringSystem(repo),
+		providers:     accrual.NewRegistry(),
+	}
+
+	body := `[
+		{"order":"100","status":"PROCESSING"},
+		{"order":"200","status":"INVALID"},
+		{"order":"100","status":"PROCESSED","accrual":500}
+	]`
+	rec := httptest.NewRecorder()
+	s.AccrualCallback(rec, httptest.NewRequest(http.MethodPost, "/internal/accrual/callback", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var result domain.CallbackResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied != 2 || len(result.Failed) != 0 {
+		t.Errorf("result = %+v, want 2 applied", result)
+	}
+
+	if len(repo.updates) != 2 {
+		t.Fatalf("stored %d updates, want 2", len(repo.updates))
+	}
+	if order := repo.updates[0].Order; order.OrderID != "100" || order.Status != domain.Processed || order.Bonuses.IntPart() != 500 {
+		t.Errorf("order 100 update = %+v, want the last PROCESSED status", order)
+	}
+	if order := repo.updates[1].Order; order.OrderID != "200" || order.Status != domain.Invalid {
+		t.Errorf("order 200 update = %+v", order)
+	}
+}
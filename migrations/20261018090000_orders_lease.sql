@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE orders
+    ADD COLUMN locked_by VARCHAR(255),
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE INDEX orders_unfinished_idx ON orders (locked_until)
+    WHERE status NOT IN ('PROCESSED', 'INVALID');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS locked_by,
+    DROP COLUMN IF EXISTS locked_until;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE orders
+    ADD COLUMN next_check_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN attempts integer NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (next_check_at)
+    WHERE status NOT IN ('PROCESSED', 'INVALID');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (locked_until)
+    WHERE status NOT IN ('PROCESSED', 'INVALID');
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS next_check_at,
+    DROP COLUMN IF EXISTS attempts;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+UPDATE orders SET status = 'PROCESSING' WHERE status = 'REGISTERED';
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+SELECT 1;
+
+-- +goose StatementEnd
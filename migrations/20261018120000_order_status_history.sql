@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE
+    order_status_history (
+        id BIGSERIAL PRIMARY KEY,
+        order_id VARCHAR(255) NOT NULL REFERENCES orders (order_id),
+        status_from VARCHAR(255),
+        status_to VARCHAR(255) NOT NULL,
+        bonuses numeric,
+        payload jsonb,
+        changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX order_status_history_order_idx ON order_status_history (order_id, changed_at);
+
+INSERT INTO order_status_history (order_id, status_from, status_to, changed_at)
+SELECT order_id, NULL, 'NEW', uploaded_at FROM orders;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS order_status_history;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (next_check_at)
+    WHERE status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+UPDATE orders SET status = 'NEW' WHERE status = 'UNREGISTERED';
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (next_check_at)
+    WHERE status NOT IN ('PROCESSED', 'INVALID');
+
+-- +goose StatementEnd
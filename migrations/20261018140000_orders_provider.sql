@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE orders ADD COLUMN provider VARCHAR(255);
+
+UPDATE orders SET provider = 'default' WHERE status IN ('PROCESSING', 'PROCESSED', 'INVALID');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+ALTER TABLE orders DROP COLUMN IF EXISTS provider;
+
+-- +goose StatementEnd
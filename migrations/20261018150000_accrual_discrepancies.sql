@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE
+    accrual_discrepancies (
+        id BIGSERIAL PRIMARY KEY,
+        order_id VARCHAR(255) NOT NULL REFERENCES orders (order_id),
+        provider VARCHAR(255) NOT NULL,
+        stored_status VARCHAR(255) NOT NULL,
+        stored_bonuses numeric,
+        remote_status VARCHAR(255),
+        remote_bonuses numeric,
+        payload jsonb,
+        corrected BOOLEAN NOT NULL DEFAULT false,
+        detected_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX accrual_discrepancies_order_idx ON accrual_discrepancies (order_id, detected_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS accrual_discrepancies;
+
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE orders ADD COLUMN failures INT NOT NULL DEFAULT 0;
+
+CREATE TABLE
+    accrual_dead_letters (
+        order_id VARCHAR(255) PRIMARY KEY REFERENCES orders (order_id),
+        failures INT NOT NULL,
+        last_error TEXT NOT NULL,
+        payload TEXT,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        discarded_at TIMESTAMPTZ
+    );
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS accrual_dead_letters;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS failures;
+
+-- +goose StatementEnd
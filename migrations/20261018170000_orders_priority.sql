@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE orders ADD COLUMN priority INT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (priority DESC, uploaded_at DESC)
+    WHERE status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS orders_unfinished_idx;
+
+CREATE INDEX orders_unfinished_idx ON orders (next_check_at)
+    WHERE status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED');
+
+ALTER TABLE orders DROP COLUMN IF EXISTS priority;
+
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE
+    ledger_entries (
+        id BIGSERIAL PRIMARY KEY,
+        user_id integer NOT NULL REFERENCES users (id),
+        kind VARCHAR(32) NOT NULL,
+        amount numeric NOT NULL,
+        reference VARCHAR(255) NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX ledger_entries_user_idx ON ledger_entries (user_id, created_at);
+
+CREATE UNIQUE INDEX ledger_entries_source_idx ON ledger_entries (kind, reference)
+    WHERE kind IN ('accrual', 'withdrawal');
+
+INSERT INTO ledger_entries (user_id, kind, amount, reference, created_at)
+SELECT o.user_id, 'accrual', o.bonuses, o.order_id,
+    COALESCE((SELECT max(h.changed_at) FROM order_status_history h
+        WHERE h.order_id = o.order_id AND h.status_to = 'PROCESSED'), o.uploaded_at)
+FROM orders o
+WHERE o.status = 'PROCESSED' AND o.bonuses <> 0;
+
+INSERT INTO ledger_entries (user_id, kind, amount, reference, created_at)
+SELECT user_id, 'withdrawal', -bonuses, order_id, uploaded_at FROM withdrawals;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS ledger_entries;
+
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE
+    balances (
+        user_id integer PRIMARY KEY REFERENCES users (id),
+        current numeric NOT NULL DEFAULT 0,
+        withdrawn numeric NOT NULL DEFAULT 0,
+        version BIGINT NOT NULL DEFAULT 0,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+INSERT INTO balances (user_id, current, withdrawn)
+SELECT u.id, COALESCE(SUM(l.amount), 0), COALESCE(-SUM(l.amount) FILTER (WHERE l.kind = 'withdrawal'), 0)
+FROM users u LEFT JOIN ledger_entries l ON l.user_id = u.id
+GROUP BY u.id;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS balances;
+
+-- +goose StatementEnd
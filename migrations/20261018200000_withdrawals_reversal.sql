@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE withdrawals ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'COMPLETED';
+
+ALTER TABLE withdrawals ADD COLUMN reversed_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS ledger_entries_source_idx;
+
+CREATE UNIQUE INDEX ledger_entries_source_idx ON ledger_entries (kind, reference)
+    WHERE kind IN ('accrual', 'withdrawal', 'reversal');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS ledger_entries_source_idx;
+
+CREATE UNIQUE INDEX ledger_entries_source_idx ON ledger_entries (kind, reference)
+    WHERE kind IN ('accrual', 'withdrawal');
+
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS reversed_at;
+
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS status;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+-- NOT VALID: ограничения действуют для новых строк и не блокируют миграцию из-за уже записанных.
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_bonuses_positive CHECK (bonuses > 0) NOT VALID;
+
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_amount_sign CHECK (
+    (kind IN ('accrual', 'reversal') AND amount > 0)
+    OR (kind = 'withdrawal' AND amount < 0)
+    OR (kind = 'adjustment' AND amount <> 0)
+) NOT VALID;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_amount_sign;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_bonuses_positive;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+-- Захват заказов на каждом раунде опроса фильтрует по next_check_at: когда большинство
+-- необработанных заказов ждёт повторной проверки, индекс по сроку проверки отсекает их,
+-- а orders_unfinished_idx остаётся для порядка захвата.
+CREATE INDEX IF NOT EXISTS orders_due_idx ON orders (next_check_at)
+    WHERE status NOT IN ('PROCESSED', 'INVALID', 'UNREGISTERED');
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS orders_due_idx;
+
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+-- Открытым остаётся одно расхождение на заказ: сверка обновляет его, а не добавляет новое каждую ночь.
+ALTER TABLE accrual_discrepancies ADD COLUMN resolved_at TIMESTAMPTZ;
+
+UPDATE accrual_discrepancies d SET resolved_at = d.detected_at
+WHERE d.corrected OR EXISTS (
+    SELECT 1 FROM accrual_discrepancies n WHERE n.order_id = d.order_id AND n.id > d.id
+);
+
+CREATE UNIQUE INDEX accrual_discrepancies_open_idx ON accrual_discrepancies (order_id) WHERE resolved_at IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS accrual_discrepancies_open_idx;
+
+ALTER TABLE accrual_discrepancies DROP COLUMN IF EXISTS resolved_at;
+
+-- +goose StatementEnd